@@ -0,0 +1,247 @@
+package bar
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+)
+
+// Bar 是一个代码在一个 ti 内的 K 线, ti 与 timescale 的定义相同: Time 为 Ti2Time(Ti), 即 [Time, Time+Scale)
+type Bar struct {
+	StockID  string
+	Ti       int
+	Time     string
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Volume   int64
+	Turnover float64
+	VWAP     float64 // Turnover / Volume, 没有成交时为 Close
+	Trades   int
+	Empty    bool // 没有成交, OHLC 为之前的 Close
+}
+
+// BarCallback 在一个 ti 结束时调用一次, bars 为所有已出现代码的 K 线, 按 StockID 排序
+type BarCallback func(ti int, bars []*Bar)
+
+type symbol struct {
+	bar      *Bar    // 当前 ti 的 K 线, 没有成交时为 nil
+	close    float64 // 最近的 Close, 用于填充没有成交的 K 线
+	volume   int64   // 快照的累计成交量/额/笔数
+	turnover int64
+	trades   int
+	snapshot bool // 收到过快照
+}
+
+/*
+Aggregator 把逐笔成交(不含撤单)或快照按 timescale 的 ti 聚合为 K 线:
+
+  - 开盘前(含集合竞价)的成交归入第 1 个 ti, 收盘(15:00:00 及之后)的成交归入最后一个 ti
+  - 收到下一个 ti 的数据, 或 OnTi/Flush 时当前 ti 结束, 中间没有数据的 ti 也会依次回调
+  - 没有成交的代码以之前的 Close 填充, 快照驱动时初始的 Close 为昨收
+  - 快照按相邻两条的累计成交量/额/笔数之差计入, 价格取最新价; 从盘中开始时第一条快照只作为基准
+  - 同一代码只应由成交或快照中的一种驱动, 否则成交会被重复计入
+  - 属于已结束 ti 的迟到数据计入当前 ti
+
+Callback 在持锁时调用, 其中不能再调用 Aggregator 的方法
+*/
+type Aggregator struct {
+	Callback BarCallback
+
+	timescale *timescale.TimeScale
+
+	mtx     sync.Mutex
+	ti      int // 当前未结束的 ti, 0 为还没有数据
+	symbols map[string]*symbol
+}
+
+func NewAggregator(callback BarCallback, opts ...Option) *Aggregator {
+	a := &Aggregator{
+		Callback:  callback,
+		timescale: timescale.DefaultTimeScale,
+		symbols:   make(map[string]*symbol),
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// TiOf 返回交易所时间 timeInt(HHMMSSmmm) 所属的 ti, 开盘前归入 1, 收盘及之后归入最后一个 ti, 时间非法时返回 -1
+func (a *Aggregator) TiOf(timeInt int) int {
+	timestr := timescale.IntTime2Time(timeInt)
+	if timestr == "" {
+		return -1
+	}
+	switch ti := a.timescale.GetTi(timestr); {
+	case ti < 0:
+		return a.timescale.MinuteSize - 1
+	case ti == 0:
+		return 1
+	default:
+		return ti
+	}
+}
+
+func (a *Aggregator) symbol(stockID string) *symbol {
+	s, ok := a.symbols[stockID]
+	if !ok {
+		s = &symbol{}
+		a.symbols[stockID] = s
+	}
+	return s
+}
+
+// advance 结束 ti 之前的所有 ti, ti 不晚于当前 ti 时不变
+func (a *Aggregator) advance(ti int) {
+	if a.ti == 0 {
+		a.ti = ti
+		return
+	}
+	for a.ti < ti {
+		a.close()
+		a.ti++
+	}
+}
+
+// close 结束当前 ti 并回调
+func (a *Aggregator) close() {
+	ids := make([]string, 0, len(a.symbols))
+	for id, s := range a.symbols {
+		if s.bar != nil || s.close > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	bars := make([]*Bar, len(ids))
+	for i, id := range ids {
+		s := a.symbols[id]
+		b := s.bar
+		if b == nil {
+			b = &Bar{Open: s.close, High: s.close, Low: s.close, Close: s.close, VWAP: s.close, Empty: true}
+		} else if b.Volume > 0 {
+			b.VWAP = b.Turnover / float64(b.Volume)
+		} else {
+			b.VWAP = b.Close
+		}
+		b.StockID, b.Ti, b.Time = id, a.ti, a.timescale.Ti2Time(a.ti)
+		bars[i] = b
+		s.bar = nil
+	}
+	if a.Callback != nil {
+		a.Callback(a.ti, bars)
+	}
+}
+
+// trade 把一笔(或一段)成交计入代码当前 ti 的 K 线
+func (s *symbol) trade(price float64, volume int64, turnover float64, trades int) {
+	b := s.bar
+	if b == nil {
+		b = &Bar{Open: price, High: price, Low: price}
+		s.bar = b
+	}
+	if price > b.High {
+		b.High = price
+	}
+	if price < b.Low {
+		b.Low = price
+	}
+	b.Close = price
+	b.Volume += volume
+	b.Turnover += turnover
+	b.Trades += trades
+	s.close = price
+}
+
+// OnTransaction 处理一笔逐笔成交, 撤单忽略
+func (a *Aggregator) OnTransaction(t *datatype.Transaction, meta *datatype.Meta) {
+	if t.FunctionCode == datatype.TransactionFuncCancel || t.Price <= 0 || t.Volume <= 0 {
+		return
+	}
+	ti := a.TiOf(t.Time)
+	if ti < 0 {
+		return
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.advance(ti)
+	a.symbol(t.StockID).trade(t.Price, int64(t.Volume), t.Price*float64(t.Volume), 1)
+}
+
+// OnSnapshot 处理一条快照
+func (a *Aggregator) OnSnapshot(snapshot *datatype.Snapshot, meta *datatype.Meta) {
+	ti := a.TiOf(snapshot.Time)
+	if ti < 0 {
+		return
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.advance(ti)
+	s := a.symbol(snapshot.StockID)
+	first := !s.snapshot
+	s.snapshot = true
+	if s.close <= 0 {
+		s.close = snapshot.PrevClose
+	}
+
+	volume, turnover, trades := snapshot.Volume-s.volume, snapshot.Turnover-s.turnover, snapshot.TradesNum-s.trades
+	s.volume, s.turnover, s.trades = snapshot.Volume, snapshot.Turnover, snapshot.TradesNum
+	if first && ti > 1 {
+		return
+	}
+	if volume > 0 && snapshot.Match > 0 {
+		s.trade(snapshot.Match, volume, float64(turnover), trades)
+	}
+}
+
+// OnMD 处理成交与快照, 可直接作为 consumer.MDCallback 使用
+func (a *Aggregator) OnMD(md *datatype.MD, meta *datatype.Meta) {
+	switch d := md.Data.(type) {
+	case *datatype.Transaction:
+		a.OnTransaction(d, meta)
+	case *datatype.Snapshot:
+		a.OnSnapshot(d, meta)
+	}
+}
+
+// OnTi 结束 ti 之前的所有 ti, 与 timgr.TiCallback 兼容, 可在数据很少时由 TiMgr 驱动
+func (a *Aggregator) OnTi(ti int) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.ti == 0 {
+		return // 还没有数据
+	}
+	if last := a.timescale.MinuteSize - 1; ti > last {
+		ti = last
+	}
+	a.advance(ti)
+}
+
+// Flush 结束当前 ti, 如收盘后
+func (a *Aggregator) Flush() {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	if a.ti == 0 {
+		return
+	}
+	a.close()
+	a.ti++
+}
+
+// Ti 返回当前未结束的 ti, 0 表示还没有数据
+func (a *Aggregator) Ti() int {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	return a.ti
+}
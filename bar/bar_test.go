@@ -0,0 +1,84 @@
+package bar
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+func trade(stockID string, time int, price float64, volume int) *datatype.Transaction {
+	return &datatype.Transaction{StockID: stockID, Time: time, Price: price, Volume: volume, FunctionCode: datatype.TransactionFuncTrans}
+}
+
+func format(b *Bar) string {
+	return fmt.Sprintf("%s %d %s %v/%v/%v/%v %d %.2f %d %v", b.StockID, b.Ti, b.Time, b.Open, b.High, b.Low, b.Close, b.Volume, b.VWAP, b.Trades, b.Empty)
+}
+
+func TestAggregator(t *testing.T) {
+	var got []string
+	a := NewAggregator(func(ti int, bars []*Bar) {
+		for _, b := range bars {
+			got = append(got, format(b))
+		}
+	})
+
+	for _, tx := range []*datatype.Transaction{
+		trade("000001.SZ", 92500000, 10.00, 1000), // 集合竞价归入 ti 1
+		trade("000001.SZ", 93000500, 10.02, 100),
+		trade("000001.SZ", 93010000, 9.98, 200),
+		{StockID: "000001.SZ", Time: 93020000, Volume: 300, FunctionCode: datatype.TransactionFuncCancel},
+		trade("600000.SH", 93059000, 8.00, 100),
+		trade("000001.SZ", 93200000, 10.05, 100), // ti 2 没有成交
+		trade("000001.SZ", 145959000, 10.10, 100),
+		trade("000001.SZ", 150000000, 10.12, 300), // 收盘集合竞价归入最后一个 ti
+	} {
+		a.OnTransaction(tx, nil)
+	}
+	a.Flush()
+
+	want := []string{
+		"000001.SZ 1 09:30:00 10/10.02/9.98/9.98 1300 10.00 3 false",
+		"600000.SH 1 09:30:00 8/8/8/8 100 8.00 1 false",
+		"000001.SZ 2 09:31:00 9.98/9.98/9.98/9.98 0 9.98 0 true",
+		"600000.SH 2 09:31:00 8/8/8/8 0 8.00 0 true",
+		"000001.SZ 3 09:32:00 10.05/10.05/10.05/10.05 100 10.05 1 false",
+		"600000.SH 3 09:32:00 8/8/8/8 0 8.00 0 true",
+	}
+	if len(got) != 2*240 {
+		t.Fatalf("bars = %d", len(got))
+	}
+	for i, w := range want {
+		if got[i] != w {
+			t.Errorf("bar %d = %s, want %s", i, got[i], w)
+		}
+	}
+	if last := got[len(got)-2]; last != "000001.SZ 240 14:59:00 10.1/10.12/10.1/10.12 400 10.11 2 false" {
+		t.Errorf("last bar = %s", last)
+	}
+}
+
+func TestAggregatorSnapshot(t *testing.T) {
+	var got []string
+	a := NewAggregator(func(ti int, bars []*Bar) {
+		for _, b := range bars {
+			got = append(got, format(b))
+		}
+	})
+
+	snapshot := func(time int, match float64, volume int64, turnover int64, trades int) *datatype.Snapshot {
+		return &datatype.Snapshot{StockID: "000001.SZ", Time: time, PrevClose: 9.9, Match: match, Volume: volume, Turnover: turnover, TradesNum: trades}
+	}
+	a.OnSnapshot(snapshot(93100000, 10, 1000, 10000, 10), nil) // 从盘中开始, 只作为基准
+	a.OnSnapshot(snapshot(93103000, 10.2, 1500, 15100, 15), nil)
+	a.OnSnapshot(snapshot(93106000, 10.1, 2000, 20150, 20), nil)
+	a.OnTi(4)
+
+	want := []string{
+		"000001.SZ 2 09:31:00 10.2/10.2/10.1/10.1 1000 10.15 10 false",
+		"000001.SZ 3 09:32:00 10.1/10.1/10.1/10.1 0 10.10 0 true",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("bars = %q", got)
+	}
+}
@@ -0,0 +1,214 @@
+package bar
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+)
+
+// Engine 各周期 timescale 的起止时间, 午休由 timescale 跳过
+const (
+	SessionStart = "09:30:00" // 第 1 个 ti 的开始, 之前的成交归入第 1 个 ti
+	SessionEnd   = "15:00:00" // 最后一个 ti 的结束, 之后的成交归入最后一个 ti
+)
+
+// resolution 是一种周期, 由更细周期的 K 线合成
+type resolution struct {
+	scale     *timescale.TimeScale
+	ti        int             // 正在合成的 ti, 0 为没有
+	bars      map[string]*Bar // 正在合成的 K 线
+	callbacks []BarCallback
+}
+
+/*
+Engine 同时生成多种周期的 K 线: 最小的周期由 Aggregator 从成交或快照聚合, 其它周期由最小周期的 K 线合成,
+因此各周期的成交量/额一致. 各周期都用 NewSessionTimeScale(SessionStart, SessionEnd, scale) 划分 ti, 午休不产生 K 线,
+下午的 K 线从 13:00:00 开始, 周期不整除上午或下午时该段最后一根 K 线较短(如 60 分钟 K 线为 09:30, 10:30, 13:00, 14:00):
+一个周期的 K 线在其最后一个最小周期的 K 线结束时结束, 如 11:29:00 的 1 分钟 K 线结束时 11:00:00 的 30 分钟 K 线也结束.
+同一 ti 各周期的回调从小到大依次调用, 回调在持锁时调用, 其中不能再调用 Engine 的方法.
+
+	e, _ := bar.NewEngine([]int{3, 60, 300, 1800})
+	e.Subscribe(60, onMinute)
+	c := consumer.NewConsumer("md", brokers, consumer.WithOrderedMD(time.Second), consumer.WithMDCallback(e.OnMD))
+*/
+type Engine struct {
+	aggregator *Aggregator // 生成最小周期, 其 Callback 为 onBar
+
+	mtx         sync.Mutex
+	resolutions map[int]*resolution // 以周期的秒数为 key
+	scales      []int               // 从小到大
+}
+
+// NewEngine 创建周期为 scales(秒)的 Engine, 其它周期须为最小周期的整数倍;
+// opts 交给生成最小周期的 Aggregator, 其中的 WithTimescale 被最小周期的 timescale 覆盖
+func NewEngine(scales []int, opts ...Option) (*Engine, error) {
+	if len(scales) == 0 {
+		return nil, fmt.Errorf("no scale")
+	}
+	sorted := append([]int(nil), scales...)
+	sort.Ints(sorted)
+
+	e := &Engine{resolutions: make(map[int]*resolution)}
+	for _, scale := range sorted {
+		if scale <= 0 || scale%sorted[0] != 0 {
+			return nil, fmt.Errorf("scale %d is not a multiple of %d", scale, sorted[0])
+		}
+		if _, ok := e.resolutions[scale]; ok {
+			continue
+		}
+		e.resolutions[scale] = &resolution{
+			scale: timescale.NewSessionTimeScale(SessionStart, SessionEnd, scale),
+			bars:  make(map[string]*Bar),
+		}
+		e.scales = append(e.scales, scale)
+	}
+	opts = append(opts[:len(opts):len(opts)], WithTimescale(*e.resolutions[e.scales[0]].scale))
+	e.aggregator = NewAggregator(e.onBar, opts...)
+	return e, nil
+}
+
+// Scales 返回各周期的秒数, 从小到大
+func (e *Engine) Scales() []int {
+	return append([]int(nil), e.scales...)
+}
+
+// Subscribe 订阅周期为 scale(秒)的 K 线, scale 须为 NewEngine 时给出的周期
+func (e *Engine) Subscribe(scale int, callback BarCallback) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	r, ok := e.resolutions[scale]
+	if !ok {
+		return fmt.Errorf("scale %d not found", scale)
+	}
+	r.callbacks = append(r.callbacks, callback)
+	return nil
+}
+
+func (r *resolution) emit(ti int, bars []*Bar) {
+	for _, cb := range r.callbacks {
+		cb(ti, bars)
+	}
+}
+
+// merge 把一根更细周期的 K 线合入 r 中同一代码正在合成的 K 线
+func (r *resolution) merge(b *Bar) {
+	dst, ok := r.bars[b.StockID]
+	if !ok || (dst.Empty && !b.Empty) {
+		clone := *b
+		r.bars[b.StockID] = &clone
+		return
+	}
+	if b.Empty {
+		return
+	}
+	if b.High > dst.High {
+		dst.High = b.High
+	}
+	if b.Low < dst.Low {
+		dst.Low = b.Low
+	}
+	dst.Close = b.Close
+	dst.Volume += b.Volume
+	dst.Turnover += b.Turnover
+	dst.Trades += b.Trades
+}
+
+// close 结束正在合成的 ti 并回调
+func (r *resolution) close() {
+	if r.ti == 0 {
+		return
+	}
+	ids := make([]string, 0, len(r.bars))
+	for id := range r.bars {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	bars := make([]*Bar, len(ids))
+	for i, id := range ids {
+		b := r.bars[id]
+		b.Ti, b.Time = r.ti, r.scale.Ti2Time(r.ti)
+		if b.Volume > 0 {
+			b.VWAP = b.Turnover / float64(b.Volume)
+		} else {
+			b.VWAP = b.Close
+		}
+		bars[i] = b
+	}
+	r.emit(r.ti, bars)
+	r.ti, r.bars = 0, make(map[string]*Bar)
+}
+
+// onBar 是最小周期的 BarCallback, 在 Aggregator 持锁时调用
+func (e *Engine) onBar(ti int, bars []*Bar) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	base := e.aggregator.timescale
+	e.resolutions[e.scales[0]].emit(ti, bars)
+
+	start, next := base.Ti2Time(ti), base.Ti2Time(ti+1)
+	for _, scale := range e.scales[1:] {
+		r := e.resolutions[scale]
+		cti := r.scale.GetTi(start)
+		if cti <= 0 {
+			continue
+		}
+		if r.ti != 0 && r.ti != cti {
+			r.close()
+		}
+		r.ti = cti
+		for _, b := range bars {
+			r.merge(b)
+		}
+		if next == "" || r.scale.GetTi(next) != cti {
+			r.close()
+		}
+	}
+}
+
+// TiOf 返回交易所时间 timeInt(HHMMSSmmm) 所属的最小周期的 ti, 见 Aggregator.TiOf
+func (e *Engine) TiOf(timeInt int) int {
+	return e.aggregator.TiOf(timeInt)
+}
+
+// Ti 返回最小周期当前未结束的 ti, 0 表示还没有数据
+func (e *Engine) Ti() int {
+	return e.aggregator.Ti()
+}
+
+// OnTransaction 处理一笔逐笔成交, 撤单忽略
+func (e *Engine) OnTransaction(t *datatype.Transaction, meta *datatype.Meta) {
+	e.aggregator.OnTransaction(t, meta)
+}
+
+// OnSnapshot 处理一条快照
+func (e *Engine) OnSnapshot(snapshot *datatype.Snapshot, meta *datatype.Meta) {
+	e.aggregator.OnSnapshot(snapshot, meta)
+}
+
+// OnMD 处理成交与快照, 可直接作为 consumer.MDCallback 使用
+func (e *Engine) OnMD(md *datatype.MD, meta *datatype.Meta) {
+	e.aggregator.OnMD(md, meta)
+}
+
+// OnTi 结束最小周期 ti 之前的所有 ti, 与 timgr.TiCallback 兼容
+func (e *Engine) OnTi(ti int) {
+	e.aggregator.OnTi(ti)
+}
+
+// Flush 结束所有周期正在生成的 K 线, 如收盘后
+func (e *Engine) Flush() {
+	e.aggregator.Flush()
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for _, scale := range e.scales[1:] {
+		e.resolutions[scale].close()
+	}
+}
@@ -0,0 +1,113 @@
+package bar
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/timescale"
+)
+
+func TestEngine(t *testing.T) {
+	if _, err := NewEngine([]int{3, 60, 100}); err == nil {
+		t.Errorf("NewEngine(3, 60, 100) should fail")
+	}
+
+	e, err := NewEngine([]int{1800, 3, 60})
+	if err != nil {
+		t.Fatalf("NewEngine: %s", err)
+	}
+	if err := e.Subscribe(300, func(int, []*Bar) {}); err == nil {
+		t.Errorf("Subscribe(300) should fail")
+	}
+
+	got := make(map[int][]string)
+	for _, scale := range e.Scales() {
+		scale := scale
+		e.Subscribe(scale, func(ti int, bars []*Bar) {
+			for _, b := range bars {
+				if !b.Empty {
+					got[scale] = append(got[scale], format(b))
+				}
+			}
+		})
+	}
+
+	for _, tx := range []struct {
+		time   int
+		price  float64
+		volume int
+	}{
+		{93000000, 10.00, 100},
+		{93001500, 10.10, 100},
+		{95959000, 10.20, 200},
+		{112959000, 10.30, 100},
+		{113000000, 10.40, 100}, // 上午最后一笔归入 11:29:57
+		{130000000, 10.50, 100},
+		{150000000, 10.60, 100},
+	} {
+		e.OnTransaction(trade("000001.SZ", tx.time, tx.price, tx.volume), nil)
+	}
+	e.Flush()
+
+	if n := len(got[3]); n != 5 {
+		t.Errorf("3s bars = %d", n)
+	}
+	want := map[int]string{
+		60: "[000001.SZ 1 09:30:00 10/10.1/10/10.1 200 10.05 2 false " +
+			"000001.SZ 30 09:59:00 10.2/10.2/10.2/10.2 200 10.20 1 false " +
+			"000001.SZ 120 11:29:00 10.3/10.4/10.3/10.4 200 10.35 2 false " +
+			"000001.SZ 121 13:00:00 10.5/10.5/10.5/10.5 100 10.50 1 false " +
+			"000001.SZ 240 14:59:00 10.6/10.6/10.6/10.6 100 10.60 1 false]",
+		1800: "[000001.SZ 1 09:30:00 10/10.2/10/10.2 400 10.12 3 false " +
+			"000001.SZ 4 11:00:00 10.3/10.4/10.3/10.4 200 10.35 2 false " +
+			"000001.SZ 5 13:00:00 10.5/10.5/10.5/10.5 100 10.50 1 false " +
+			"000001.SZ 8 14:30:00 10.6/10.6/10.6/10.6 100 10.60 1 false]",
+	}
+	for scale, w := range want {
+		if g := fmt.Sprint(got[scale]); g != w {
+			t.Errorf("%ds bars = %s", scale, g)
+		}
+	}
+}
+
+func TestEngineOptions(t *testing.T) {
+	// 最小周期的 timescale 覆盖传入的 WithTimescale
+	e, err := NewEngine([]int{60}, WithTimescale(*timescale.DefaultTimeScale))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti := e.TiOf(93100000); ti != 2 {
+		t.Errorf("TiOf(09:31:00) = %d, want 2", ti)
+	}
+}
+
+func TestEngineSessionScales(t *testing.T) {
+	e, err := NewEngine([]int{60, 2700, 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[int][]string)
+	for _, scale := range []int{2700, 3600} {
+		scale := scale
+		e.Subscribe(scale, func(ti int, bars []*Bar) {
+			for _, b := range bars {
+				if !b.Empty {
+					got[scale] = append(got[scale], fmt.Sprintf("%s %d", b.Time, b.Volume))
+				}
+			}
+		})
+	}
+	e.OnTransaction(trade("000001.SZ", 112900000, 10, 100), nil)
+	e.OnTransaction(trade("000001.SZ", 130500000, 10, 200), nil)
+	e.OnTransaction(trade("000001.SZ", 145900000, 10, 300), nil)
+	e.Flush()
+
+	// 周期不整除 09:30 到 13:00 时, 下午的 K 线仍从 13:00:00 开始, 不与上午合并
+	if g := fmt.Sprint(got[2700]); g != "[11:00:00 100 13:00:00 200 14:30:00 300]" {
+		t.Errorf("2700s bars = %s", g)
+	}
+	if g := fmt.Sprint(got[3600]); g != "[10:30:00 100 13:00:00 200 14:00:00 300]" {
+		t.Errorf("3600s bars = %s", g)
+	}
+}
@@ -0,0 +1,11 @@
+package bar
+
+import "github.com/2997215859/gomdsdk/timescale"
+
+type Option func(a *Aggregator)
+
+func WithTimescale(scale timescale.TimeScale) Option {
+	return func(a *Aggregator) {
+		a.timescale = &scale
+	}
+}
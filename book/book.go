@@ -0,0 +1,488 @@
+package book
+
+import (
+	"container/list"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+type Side int
+
+const (
+	Bid Side = 1
+	Ask Side = 2
+)
+
+func (s Side) String() string {
+	switch s {
+	case Bid:
+		return "bid"
+	case Ask:
+		return "ask"
+	}
+	return "unknown"
+}
+
+// SideOf 按委托代码(datatype.OrderFuncBuy/OrderFuncSell)返回买卖方向, 其它返回 0
+func SideOf(functionCode string) Side {
+	switch functionCode {
+	case datatype.OrderFuncBuy:
+		return Bid
+	case datatype.OrderFuncSell:
+		return Ask
+	}
+	return 0
+}
+
+// PriceScale 价格按 1/PriceScale 取整后作为价位的 key, 避免浮点数比较
+const PriceScale = 10000
+
+func priceKey(price float64) int64 {
+	return int64(math.Round(price * PriceScale))
+}
+
+// Order 是簿中的一笔委托, Volume 为剩余数量
+type Order struct {
+	ID     int64
+	Side   Side
+	Kind   string // datatype.OrderKindXXX
+	Price  float64
+	Volume int64
+	Time   int
+
+	level     *level
+	elem      *list.Element
+	lastPrice float64 // 市价委托最近一次成交的价格
+}
+
+// Placed 表示委托已挂在某个价位上; 市价委托在成交完之前, 以及找不到价格的本方/对手方最优委托不在簿中
+func (o *Order) Placed() bool {
+	return o.level != nil
+}
+
+type level struct {
+	key    int64
+	price  float64
+	volume int64
+	orders *list.List // *Order, 按时间优先
+}
+
+// PriceLevel 是一个价位的汇总
+type PriceLevel struct {
+	Price  float64
+	Volume int64
+	Orders int
+}
+
+// Position 是委托在价位队列中的位置: 排在它前面的委托数与数量
+type Position struct {
+	Orders int
+	Volume int64
+}
+
+/*
+Book 是一个代码的全档位逐笔委托簿, 由逐笔委托与逐笔成交(含撤单)驱动, 可在其它 goroutine 中并发查询:
+
+  - 限价委托挂在委托价上, 本方最优挂在到达时的本方最优价, 对手方最优挂在到达时的对手方最优价
+  - 市价委托不挂单, 成交后的剩余在下一个与它无关的事件到达时按最后成交价挂出, 撤单随时可以撤掉
+  - 成交按 BidOrder/AskOrder 减少双方剩余数量, 撤单按 Volume 减少被撤委托的剩余数量
+
+沪深逐笔的差异由 NormalizeXXX 转换为统一的 Event 后通过 Apply 处理
+*/
+type Book struct {
+	StockID string
+
+	mtx     sync.RWMutex
+	bids    []*level // 价格从高到低
+	asks    []*level // 价格从低到高
+	orders  map[int64]*Order
+	pending *Order // 尚未挂出的市价委托
+
+	lastPrice float64
+	volume    int64
+	turnover  float64
+	time      int
+	offset    int64 // 最近一个带 offset 的事件的 offset
+}
+
+func NewBook(stockID string) *Book {
+	return &Book{
+		StockID: stockID,
+		orders:  make(map[int64]*Order),
+		offset:  -1,
+	}
+}
+
+func (b *Book) levels(side Side) *[]*level {
+	if side == Bid {
+		return &b.bids
+	}
+	return &b.asks
+}
+
+// search 返回 key 在 side 一侧的位置, 及该位置上是否正是 key 的价位
+func (b *Book) search(side Side, key int64) (int, bool) {
+	levels := *b.levels(side)
+	i := sort.Search(len(levels), func(i int) bool {
+		if side == Bid {
+			return levels[i].key <= key
+		}
+		return levels[i].key >= key
+	})
+	return i, i < len(levels) && levels[i].key == key
+}
+
+func (b *Book) place(o *Order) {
+	key := priceKey(o.Price)
+	levels := b.levels(o.Side)
+	i, ok := b.search(o.Side, key)
+	if !ok {
+		l := &level{key: key, price: o.Price, orders: list.New()}
+		*levels = append(*levels, nil)
+		copy((*levels)[i+1:], (*levels)[i:])
+		(*levels)[i] = l
+	}
+
+	l := (*levels)[i]
+	o.level = l
+	o.elem = l.orders.PushBack(o)
+	l.volume += o.Volume
+}
+
+// reduce 减少委托的剩余数量, 减到 0 时从簿中移除
+func (b *Book) reduce(o *Order, volume int64) {
+	if volume <= 0 || volume > o.Volume {
+		volume = o.Volume
+	}
+	o.Volume -= volume
+
+	if l := o.level; l != nil {
+		l.volume -= volume
+		if o.Volume == 0 {
+			l.orders.Remove(o.elem)
+			o.level, o.elem = nil, nil
+			if l.orders.Len() == 0 {
+				b.removeLevel(o.Side, l)
+			}
+		}
+	}
+	if o.Volume == 0 {
+		delete(b.orders, o.ID)
+		if b.pending == o {
+			b.pending = nil
+		}
+	}
+}
+
+func (b *Book) removeLevel(side Side, l *level) {
+	levels := b.levels(side)
+	if i, ok := b.search(side, l.key); ok {
+		*levels = append((*levels)[:i], (*levels)[i+1:]...)
+	}
+}
+
+func (b *Book) best(side Side) (float64, bool) {
+	levels := *b.levels(side)
+	if len(levels) == 0 {
+		return 0, false
+	}
+	return levels[0].price, true
+}
+
+func opposite(side Side) Side {
+	if side == Bid {
+		return Ask
+	}
+	return Bid
+}
+
+// settle 把与当前事件无关的市价委托按最后成交价挂出
+func (b *Book) settle(id ...int64) {
+	o := b.pending
+	if o == nil {
+		return
+	}
+	for _, i := range id {
+		if i == o.ID {
+			return
+		}
+	}
+
+	b.pending = nil
+	if o.lastPrice > 0 {
+		o.Price = o.lastPrice
+		b.place(o)
+	}
+}
+
+// Add 加入一笔委托, kind 为 datatype.OrderKindXXX, 空字符串按限价处理
+func (b *Book) Add(id int64, side Side, kind string, price float64, volume int64, time int) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.settle()
+	b.add(id, side, kind, price, volume, time)
+}
+
+func (b *Book) add(id int64, side Side, kind string, price float64, volume int64, time int) {
+	if time > 0 {
+		b.time = time
+	}
+	if volume <= 0 || (side != Bid && side != Ask) {
+		return
+	}
+	if _, ok := b.orders[id]; ok {
+		return
+	}
+
+	o := &Order{ID: id, Side: side, Kind: kind, Price: price, Volume: volume, Time: time}
+	b.orders[id] = o
+
+	switch kind {
+	case datatype.OrderKindMkt:
+		o.Price = 0
+		b.pending = o
+		return
+	case datatype.OrderKindUsf:
+		var ok bool
+		if o.Price, ok = b.best(side); !ok {
+			return // 本方无委托时会被撤单
+		}
+	case datatype.OrderKindUcf:
+		var ok bool
+		if o.Price, ok = b.best(opposite(side)); !ok {
+			return // 对手方无委托时会被撤单
+		}
+	}
+	b.place(o)
+}
+
+// Cancel 撤销委托 id 的 volume 数量, volume <= 0 时全部撤销; 找不到委托时返回 false
+func (b *Book) Cancel(id int64, volume int64, time int) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.settle(id)
+	return b.cancel(id, volume, time)
+}
+
+func (b *Book) cancel(id int64, volume int64, time int) bool {
+	if time > 0 {
+		b.time = time
+	}
+	o, ok := b.orders[id]
+	if !ok {
+		return false
+	}
+	b.reduce(o, volume)
+	return true
+}
+
+// Fill 按一笔成交减少买卖双方委托的剩余数量, 找不到的委托(如从盘中开始构建)忽略
+func (b *Book) Fill(bidID, askID int64, price float64, volume int64, time int) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.settle(bidID, askID)
+	b.fill(bidID, askID, price, volume, time)
+}
+
+func (b *Book) fill(bidID, askID int64, price float64, volume int64, time int) {
+	if time > 0 {
+		b.time = time
+	}
+	for _, id := range []int64{bidID, askID} {
+		if o, ok := b.orders[id]; ok {
+			o.lastPrice = price
+			b.reduce(o, volume)
+		}
+	}
+
+	b.lastPrice = price
+	b.volume += volume
+	b.turnover += price * float64(volume)
+}
+
+// Modify 把委托 id 的价格与剩余数量改为 price, volume: 改价或增加数量时排到新价位的末尾, 只减少数量时保持时间优先
+func (b *Book) Modify(id int64, price float64, volume int64, time int) bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.settle(id)
+	return b.modify(id, price, volume, time)
+}
+
+func (b *Book) modify(id int64, price float64, volume int64, time int) bool {
+	if time > 0 {
+		b.time = time
+	}
+	o, ok := b.orders[id]
+	if !ok {
+		return false
+	}
+	if volume <= 0 {
+		b.reduce(o, 0)
+		return true
+	}
+	if o.level != nil && priceKey(price) == o.level.key && volume <= o.Volume {
+		b.reduce(o, o.Volume-volume)
+		return true
+	}
+
+	if l := o.level; l != nil {
+		l.volume -= o.Volume
+		l.orders.Remove(o.elem)
+		o.level, o.elem = nil, nil
+		if l.orders.Len() == 0 {
+			b.removeLevel(o.Side, l)
+		}
+	}
+	if b.pending == o {
+		b.pending = nil
+	}
+	o.Price, o.Volume = price, volume
+	if time > 0 {
+		o.Time = time
+	}
+	b.place(o)
+	return true
+}
+
+// Apply 处理一个事件, 见 NormalizeXXX
+func (b *Book) Apply(e Event) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if e.Offset >= 0 {
+		b.offset = e.Offset
+	}
+	switch e.Kind {
+	case EventAdd:
+		b.settle()
+		b.add(e.ID, e.Side, e.OrderKind, e.Price, e.Volume, e.Time)
+	case EventModify:
+		b.settle(e.ID)
+		b.modify(e.ID, e.Price, e.Volume, e.Time)
+	case EventCancel:
+		b.settle(e.ID)
+		b.cancel(e.ID, e.Volume, e.Time)
+	case EventFill:
+		b.settle(e.BidID, e.AskID)
+		b.fill(e.BidID, e.AskID, e.Price, e.Volume, e.Time)
+	}
+}
+
+// OnOrder 处理一条逐笔委托, 按 StockID 的后缀区分沪深, 见 NormalizeOrder
+func (b *Book) OnOrder(o *datatype.Order) {
+	if e, ok := NormalizeOrder(o); ok {
+		b.Apply(e)
+	}
+}
+
+// OnTransaction 处理一条逐笔成交或撤单
+func (b *Book) OnTransaction(t *datatype.Transaction) {
+	if e, ok := NormalizeTransaction(t); ok {
+		b.Apply(e)
+	}
+}
+
+func summarize(l *level) PriceLevel {
+	return PriceLevel{Price: l.price, Volume: l.volume, Orders: l.orders.Len()}
+}
+
+// Depth 返回买卖各前 n 档, n <= 0 时返回全部档位
+func (b *Book) Depth(n int) (bids, asks []PriceLevel) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	top := func(levels []*level) []PriceLevel {
+		if n > 0 && len(levels) > n {
+			levels = levels[:n]
+		}
+		out := make([]PriceLevel, len(levels))
+		for i, l := range levels {
+			out[i] = summarize(l)
+		}
+		return out
+	}
+	return top(b.bids), top(b.asks)
+}
+
+func (b *Book) BestBid() (PriceLevel, bool) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if len(b.bids) == 0 {
+		return PriceLevel{}, false
+	}
+	return summarize(b.bids[0]), true
+}
+
+func (b *Book) BestAsk() (PriceLevel, bool) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	if len(b.asks) == 0 {
+		return PriceLevel{}, false
+	}
+	return summarize(b.asks[0]), true
+}
+
+// Order 返回委托 id 的副本
+func (b *Book) Order(id int64) (Order, bool) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	o, ok := b.orders[id]
+	if !ok {
+		return Order{}, false
+	}
+	clone := *o
+	clone.elem = nil
+	return clone, true
+}
+
+// QueuePosition 返回委托 id 在其价位上排在前面的委托数与数量, 委托不在簿中时返回 false
+func (b *Book) QueuePosition(id int64) (Position, bool) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	o, ok := b.orders[id]
+	if !ok || o.level == nil {
+		return Position{}, false
+	}
+
+	var pos Position
+	for e := o.level.orders.Front(); e != nil && e != o.elem; e = e.Next() {
+		pos.Orders++
+		pos.Volume += e.Value.(*Order).Volume
+	}
+	return pos, true
+}
+
+// Trade 返回最新成交价, 累计成交量与成交额
+func (b *Book) Trade() (lastPrice float64, volume int64, turnover float64) {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	return b.lastPrice, b.volume, b.turnover
+}
+
+// Time 返回最近一个事件的交易所时间(HHMMSSmmm)
+func (b *Book) Time() int {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	return b.time
+}
+
+// Offset 返回最近一个通过 Apply 处理且带 offset 的事件的 offset, 没有时为 -1
+func (b *Book) Offset() int64 {
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+
+	return b.offset
+}
@@ -0,0 +1,89 @@
+package book
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+func order(id int, functionCode string, kind string, price float64, volume float64) *datatype.Order {
+	return &datatype.Order{StockID: "000001.SZ", Time: 93000000 + id, Order: id, Price: price, Volume: volume, OrderKind: kind, FunctionCode: functionCode, Channel: 2011}
+}
+
+func trade(id int, bidOrder int, askOrder int, price float64, volume int) *datatype.Transaction {
+	return &datatype.Transaction{StockID: "000001.SZ", Time: 93000000 + id, Index: id, Price: price, Volume: volume, FunctionCode: datatype.TransactionFuncTrans, BidOrder: bidOrder, AskOrder: askOrder, Channel: 2011}
+}
+
+func cancel(id int, bidOrder int, askOrder int, volume int) *datatype.Transaction {
+	return &datatype.Transaction{StockID: "000001.SZ", Time: 93000000 + id, Index: id, Volume: volume, FunctionCode: datatype.TransactionFuncCancel, BidOrder: bidOrder, AskOrder: askOrder, Channel: 2011}
+}
+
+func TestBook(t *testing.T) {
+	b := NewBook("000001.SZ")
+	for _, md := range []interface{}{
+		order(1, "B", datatype.OrderKindFix, 11.36, 100),
+		order(2, "B", datatype.OrderKindFix, 11.37, 200),
+		order(3, "B", datatype.OrderKindFix, 11.37, 300),
+		order(4, "S", datatype.OrderKindFix, 11.39, 500),
+		order(5, "S", datatype.OrderKindFix, 11.38, 400),
+		// 卖出 250 吃掉 2 与 3 的一部分
+		order(6, "S", datatype.OrderKindFix, 11.37, 250),
+		trade(7, 2, 6, 11.37, 200),
+		trade(8, 3, 6, 11.37, 50),
+		order(9, "B", datatype.OrderKindUsf, 0, 100),  // 本方最优 11.37
+		order(10, "S", datatype.OrderKindUcf, 0, 100), // 对手方最优 11.37
+		trade(11, 3, 10, 11.37, 100),
+		cancel(12, 0, 4, 200), // 部分撤单
+		// 市价买入成交 400@11.38 与 100@11.39, 剩余被撤
+		order(13, "B", datatype.OrderKindMkt, 0, 600),
+		trade(14, 13, 5, 11.38, 400),
+		trade(15, 13, 4, 11.39, 100),
+		cancel(16, 13, 0, 100),
+	} {
+		switch d := md.(type) {
+		case *datatype.Order:
+			b.OnOrder(d)
+		case *datatype.Transaction:
+			b.OnTransaction(d)
+		}
+	}
+
+	bids, asks := b.Depth(5)
+	if got := fmt.Sprint(bids); got != "[{11.37 250 2} {11.36 100 1}]" {
+		t.Errorf("bids = %s", got)
+	}
+	if got := fmt.Sprint(asks); got != "[{11.39 200 1}]" {
+		t.Errorf("asks = %s", got)
+	}
+
+	pos, ok := b.QueuePosition(9)
+	if !ok || pos.Orders != 1 || pos.Volume != 150 {
+		t.Errorf("position of 9 = %+v, %v, want 1 order 150 ahead", pos, ok)
+	}
+	if _, ok := b.Order(13); ok {
+		t.Errorf("market order 13 should be removed")
+	}
+
+	lastPrice, volume, _ := b.Trade()
+	if lastPrice != 11.39 || volume != 850 {
+		t.Errorf("trade = %v %v, want 11.39 850", lastPrice, volume)
+	}
+}
+
+func TestMarketOrderRemainder(t *testing.T) {
+	b := NewBook("000001.SZ")
+	b.OnOrder(order(1, "S", datatype.OrderKindFix, 11.38, 100))
+	b.OnOrder(order(2, "B", datatype.OrderKindMkt, 0, 300))
+	b.OnTransaction(trade(3, 2, 1, 11.38, 100))
+	if bids, _ := b.Depth(0); len(bids) != 0 {
+		t.Errorf("market order placed before next event: %v", bids)
+	}
+
+	// 下一个无关事件到达时, 剩余按最后成交价挂出
+	b.OnOrder(order(4, "S", datatype.OrderKindFix, 11.40, 100))
+	bids, _ := b.Depth(0)
+	if fmt.Sprint(bids) != "[{11.38 200 1}]" {
+		t.Errorf("bids = %v, want [{11.38 200 1}]", bids)
+	}
+}
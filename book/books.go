@@ -0,0 +1,69 @@
+package book
+
+import (
+	"sync"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+/*
+Books 按代码维护 Book, OnMD 可直接作为 consumer.MDCallback 使用:
+
+	books := book.NewBooks()
+	c := consumer.NewConsumer("md", brokers, consumer.WithOrderedMD(time.Second), consumer.WithMDCallback(books.OnMD))
+*/
+type Books struct {
+	mtx   sync.RWMutex
+	books map[string]*Book
+}
+
+func NewBooks() *Books {
+	return &Books{books: make(map[string]*Book)}
+}
+
+// Get 返回 stockID 的 Book, 不存在时创建
+func (bs *Books) Get(stockID string) *Book {
+	bs.mtx.RLock()
+	b, ok := bs.books[stockID]
+	bs.mtx.RUnlock()
+	if ok {
+		return b
+	}
+
+	bs.mtx.Lock()
+	defer bs.mtx.Unlock()
+
+	if b, ok = bs.books[stockID]; !ok {
+		b = NewBook(stockID)
+		bs.books[stockID] = b
+	}
+	return b
+}
+
+func (bs *Books) Book(stockID string) (*Book, bool) {
+	bs.mtx.RLock()
+	defer bs.mtx.RUnlock()
+
+	b, ok := bs.books[stockID]
+	return b, ok
+}
+
+// Apply 把事件交给 e.StockID 的 Book
+func (bs *Books) Apply(e Event) {
+	bs.Get(e.StockID).Apply(e)
+}
+
+func (bs *Books) OnOrder(o *datatype.Order, meta *datatype.Meta) {
+	bs.OnMD(&datatype.MD{Type: datatype.TypeOrder, Data: o}, meta)
+}
+
+func (bs *Books) OnTransaction(t *datatype.Transaction, meta *datatype.Meta) {
+	bs.OnMD(&datatype.MD{Type: datatype.TypeTransaction, Data: t}, meta)
+}
+
+// OnMD 处理逐笔委托与成交, 忽略其它数据
+func (bs *Books) OnMD(md *datatype.MD, meta *datatype.Meta) {
+	if e, ok := Normalize(md, meta); ok {
+		bs.Apply(e)
+	}
+}
@@ -0,0 +1,205 @@
+package book
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+)
+
+// Divergence 是 Book 与快照中不一致的一项, Field 为快照的 json 字段名, 如 bid_prices[0], volume
+type Divergence struct {
+	Field    string
+	Book     float64
+	Snapshot float64
+}
+
+func (d Divergence) String() string {
+	return fmt.Sprintf("%s: book %v, snapshot %v", d.Field, d.Book, d.Snapshot)
+}
+
+/*
+Report 是一次不一致的比较结果:
+BookOffset 是比较时最后应用到 Book 的事件的 offset, GoodOffset 是上一次一致时的 BookOffset(没有时为 -1),
+丢数据或 Book 的问题出在 (GoodOffset, BookOffset] 之间的事件中
+*/
+type Report struct {
+	StockID        string
+	Time           int // 快照时间
+	SnapshotOffset int64
+	BookOffset     int64
+	GoodOffset     int64
+	Divergences    []Divergence
+}
+
+// ReportCallback 在 Checker.OnMD/OnSnapshot 的 goroutine 中调用
+type ReportCallback func(r *Report)
+
+type CheckStats struct {
+	Checks    int64 // 比较次数
+	Divergent int64 // 不一致的次数
+	Skipped   int64 // 不在连续竞价时段或没有 Book 而跳过的快照数
+}
+
+// Continuous 表示 timeInt(HHMMSSmmm) 在连续竞价时段内, 集合竞价时快照的档位是虚拟撮合的结果, 与委托簿不可比
+func Continuous(timeInt int) bool {
+	return (timeInt >= 93000000 && timeInt < 113000000) || (timeInt >= 130000000 && timeInt < 145700000)
+}
+
+type checkState struct {
+	last int64 // 上次比较的快照时间, 自 00:00:00 起的毫秒数
+	good int64
+}
+
+/*
+Checker 定期把 Book 的前 Levels 档与累计成交量/额同最新的快照比较, 发现丢数据或 Book 的错误.
+Book 必须从开盘前开始构建, 且快照与逐笔按交易所时间有序到达(如 consumer.WithOrderedMD),
+快照到达时 Book 恰好处理完快照时间之前的逐笔:
+
+	checker := book.NewChecker(book.NewBooks(), onReport, 10*time.Second)
+	c := consumer.NewConsumer("md", brokers, consumer.WithOrderedMD(time.Second), consumer.WithMDCallback(checker.OnMD))
+*/
+type Checker struct {
+	Books             *Books
+	Callback          ReportCallback
+	Interval          time.Duration                   // 同一代码两次比较之间至少间隔的交易所时间, 0 时每个快照都比较
+	Levels            int                             // 比较的档数, 默认 datatype.MaxLevels
+	VolumeScale       float64                         // 快照中的数量乘以 VolumeScale 后与 Book 比较, 默认 1
+	TurnoverTolerance float64                         // 允许的成交额误差, 默认 1
+	Filter            func(s *datatype.Snapshot) bool // 返回 false 的快照不比较, 默认只比较连续竞价时段
+
+	mtx    sync.Mutex
+	states map[string]*checkState
+	stats  CheckStats
+}
+
+func NewChecker(books *Books, callback ReportCallback, interval time.Duration) *Checker {
+	return &Checker{
+		Books:             books,
+		Callback:          callback,
+		Interval:          interval,
+		Levels:            datatype.MaxLevels,
+		VolumeScale:       1,
+		TurnoverTolerance: 1,
+		Filter: func(s *datatype.Snapshot) bool {
+			return Continuous(s.Time)
+		},
+		states: make(map[string]*checkState),
+	}
+}
+
+// OnMD 把逐笔交给 Books, 快照交给 OnSnapshot, 可直接作为 consumer.MDCallback 使用
+func (c *Checker) OnMD(md *datatype.MD, meta *datatype.Meta) {
+	if s, ok := md.Data.(*datatype.Snapshot); ok {
+		c.OnSnapshot(s, meta)
+		return
+	}
+	c.Books.OnMD(md, meta)
+}
+
+// OnSnapshot 在距上次比较超过 Interval 时比较, 不一致时调用 Callback
+func (c *Checker) OnSnapshot(s *datatype.Snapshot, meta *datatype.Meta) {
+	b, ok := c.Books.Book(s.StockID)
+	if !ok || (c.Filter != nil && !c.Filter(s)) {
+		c.mtx.Lock()
+		c.stats.Skipped++
+		c.mtx.Unlock()
+		return
+	}
+
+	millis := timescale.IntTime2Millis(s.Time)
+	c.mtx.Lock()
+	state, ok := c.states[s.StockID]
+	if !ok {
+		state = &checkState{last: math.MinInt64, good: -1}
+		c.states[s.StockID] = state
+	}
+	if state.last != math.MinInt64 && millis-state.last < c.Interval.Milliseconds() {
+		c.mtx.Unlock()
+		return
+	}
+	state.last = millis
+	c.stats.Checks++
+	c.mtx.Unlock()
+
+	divergences := c.Compare(b, s)
+	offset := b.Offset()
+
+	c.mtx.Lock()
+	good := state.good
+	if len(divergences) == 0 {
+		state.good = offset
+	} else {
+		c.stats.Divergent++
+	}
+	c.mtx.Unlock()
+
+	if len(divergences) == 0 || c.Callback == nil {
+		return
+	}
+	r := &Report{
+		StockID:        s.StockID,
+		Time:           s.Time,
+		SnapshotOffset: -1,
+		BookOffset:     offset,
+		GoodOffset:     good,
+		Divergences:    divergences,
+	}
+	if meta != nil {
+		r.SnapshotOffset = meta.Offset
+	}
+	c.Callback(r)
+}
+
+// Compare 返回 b 与 s 不一致的各项, 快照中价格为 0 的档位表示没有委托
+func (c *Checker) Compare(b *Book, s *datatype.Snapshot) []Divergence {
+	levels := c.Levels
+	if levels <= 0 {
+		levels = datatype.MaxLevels
+	}
+	scale := c.VolumeScale
+	if scale <= 0 {
+		scale = 1
+	}
+
+	var divergences []Divergence
+	bids, asks := b.Depth(levels)
+	side := func(name string, book []PriceLevel, prices, volumes []float64) {
+		for i := 0; i < levels; i++ {
+			var want, got PriceLevel
+			if i < len(prices) && i < len(volumes) && prices[i] > 0 {
+				want = PriceLevel{Price: prices[i], Volume: int64(math.Round(volumes[i] * scale))}
+			}
+			if i < len(book) {
+				got = book[i]
+			}
+			if priceKey(got.Price) != priceKey(want.Price) {
+				divergences = append(divergences, Divergence{Field: fmt.Sprintf("%s_prices[%d]", name, i), Book: got.Price, Snapshot: want.Price})
+			}
+			if got.Volume != want.Volume {
+				divergences = append(divergences, Divergence{Field: fmt.Sprintf("%s_volumes[%d]", name, i), Book: float64(got.Volume), Snapshot: float64(want.Volume)})
+			}
+		}
+	}
+	side("bid", bids, s.BidPrices, s.BidVolumes)
+	side("ask", asks, s.AskPrices, s.AskVolumes)
+
+	_, volume, turnover := b.Trade()
+	if volume != s.Volume {
+		divergences = append(divergences, Divergence{Field: "volume", Book: float64(volume), Snapshot: float64(s.Volume)})
+	}
+	if math.Abs(turnover-float64(s.Turnover)) > c.TurnoverTolerance {
+		divergences = append(divergences, Divergence{Field: "turnover", Book: turnover, Snapshot: float64(s.Turnover)})
+	}
+	return divergences
+}
+
+func (c *Checker) Stats() CheckStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.stats
+}
@@ -0,0 +1,64 @@
+package book
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+func snapshot(time int, bids, asks []PriceLevel, volume int64, turnover int64) *datatype.Snapshot {
+	s := &datatype.Snapshot{StockID: "000001.SZ", Time: time, Volume: volume, Turnover: turnover}
+	for i := 0; i < datatype.MaxLevels; i++ {
+		var bid, ask PriceLevel
+		if i < len(bids) {
+			bid = bids[i]
+		}
+		if i < len(asks) {
+			ask = asks[i]
+		}
+		s.BidPrices = append(s.BidPrices, bid.Price)
+		s.BidVolumes = append(s.BidVolumes, float64(bid.Volume))
+		s.AskPrices = append(s.AskPrices, ask.Price)
+		s.AskVolumes = append(s.AskVolumes, float64(ask.Volume))
+	}
+	return s
+}
+
+func TestChecker(t *testing.T) {
+	var reports []*Report
+	checker := NewChecker(NewBooks(), func(r *Report) {
+		reports = append(reports, r)
+	}, 0)
+
+	mds := load(t, "testdata/sz.jsonl")
+	for i, md := range mds[:8] {
+		checker.OnMD(md, &datatype.Meta{Offset: int64(i)})
+	}
+	// 与 Book 一致
+	checker.OnSnapshot(snapshot(93000055, []PriceLevel{{11.36, 100, 1}}, []PriceLevel{{11.38, 350, 1}}, 300, 3412), &datatype.Meta{Offset: 100})
+
+	// 丢失 offset 8 的撤单
+	for i, md := range mds[9:] {
+		checker.OnMD(md, &datatype.Meta{Offset: int64(9 + i)})
+	}
+	checker.OnSnapshot(snapshot(93000090, []PriceLevel{{11.30, 300, 1}}, []PriceLevel{{11.38, 450, 2}}, 300, 3412), &datatype.Meta{Offset: 101})
+
+	// 集合竞价的快照不比较
+	checker.OnSnapshot(snapshot(92500000, nil, nil, 0, 0), &datatype.Meta{Offset: 102})
+
+	if stats := checker.Stats(); stats != (CheckStats{Checks: 2, Divergent: 1, Skipped: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("reports = %d", len(reports))
+	}
+	r := reports[0]
+	if r.SnapshotOffset != 101 || r.BookOffset != 10 || r.GoodOffset != 7 {
+		t.Errorf("report offsets = %d %d %d", r.SnapshotOffset, r.BookOffset, r.GoodOffset)
+	}
+	want := "[bid_prices[0]: book 11.36, snapshot 11.3 bid_volumes[0]: book 100, snapshot 300 bid_prices[1]: book 11.3, snapshot 0 bid_volumes[1]: book 300, snapshot 0]"
+	if got := fmt.Sprint(r.Divergences); got != want {
+		t.Errorf("divergences = %s", got)
+	}
+}
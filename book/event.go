@@ -0,0 +1,191 @@
+package book
+
+import (
+	"math"
+	"strings"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+type EventKind int
+
+const (
+	EventAdd    EventKind = iota + 1 // 新增委托
+	EventModify                      // 改单, 交易所逐笔数据中没有, 供其它来源使用
+	EventCancel                      // 撤单
+	EventFill                        // 成交
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventAdd:
+		return "add"
+	case EventModify:
+		return "modify"
+	case EventCancel:
+		return "cancel"
+	case EventFill:
+		return "fill"
+	}
+	return "unknown"
+}
+
+// Event 是与交易所无关的逐笔事件, 由 NormalizeXXX 从逐笔委托与成交转换而来
+type Event struct {
+	Kind      EventKind
+	StockID   string
+	Time      int
+	Channel   int
+	Seq       int64  // 通道内的序号: 深交所为 ApplSeqNum, 上交所为 BizIndex
+	ID        int64  // Add/Modify/Cancel 的委托号
+	Side      Side   // Add/Modify/Cancel 的买卖方向, 撤单时可能为 0
+	OrderKind string // Add 的 datatype.OrderKindXXX
+	Price     float64
+	Volume    int64 // Add: 委托数量, Modify: 新的剩余数量, Cancel: 撤单数量(<= 0 时全撤), Fill: 成交数量
+	BidID     int64 // Fill 的买方委托号
+	AskID     int64 // Fill 的卖方委托号
+	Offset    int64 // 来源消息的 offset, 没有 meta 时为 -1
+}
+
+func volumeOf(v float64) int64 {
+	return int64(math.Round(v))
+}
+
+/*
+NormalizeSZOrder 转换深交所逐笔委托: 委托号为 ApplSeqNum(Order), Volume 为全部委托数量,
+主动成交的部分随后以逐笔成交的形式到达
+*/
+func NormalizeSZOrder(o *datatype.Order) (Event, bool) {
+	return Event{
+		Kind:      EventAdd,
+		StockID:   o.StockID,
+		Time:      o.Time,
+		Channel:   o.Channel,
+		Seq:       int64(o.Order),
+		ID:        int64(o.Order),
+		Side:      SideOf(o.FunctionCode),
+		OrderKind: o.OrderKind,
+		Price:     o.Price,
+		Volume:    volumeOf(o.Volume),
+		Offset:    -1,
+	}, true
+}
+
+// NormalizeSZTransaction 转换深交所逐笔成交, FunctionCode "C" 为撤单, BidOrder/AskOrder 中非 0 的一方为被撤委托
+func NormalizeSZTransaction(t *datatype.Transaction) (Event, bool) {
+	e := Event{
+		StockID: t.StockID,
+		Time:    t.Time,
+		Channel: t.Channel,
+		Seq:     int64(t.Index),
+		Price:   t.Price,
+		Volume:  int64(t.Volume),
+		Offset:  -1,
+	}
+	if t.FunctionCode == datatype.TransactionFuncCancel {
+		e.Kind, e.Price = EventCancel, 0
+		if t.BidOrder != 0 {
+			e.ID, e.Side = int64(t.BidOrder), Bid
+		} else {
+			e.ID, e.Side = int64(t.AskOrder), Ask
+		}
+		return e, true
+	}
+	e.Kind, e.BidID, e.AskID = EventFill, int64(t.BidOrder), int64(t.AskOrder)
+	return e, true
+}
+
+func shOrderID(o *datatype.Order) int64 {
+	if o.OrderOriNo > 0 {
+		return o.OrderOriNo
+	}
+	return int64(o.Order)
+}
+
+func shSeq(bizIndex int64, seq int) int64 {
+	if bizIndex > 0 {
+		return bizIndex
+	}
+	return int64(seq)
+}
+
+/*
+NormalizeSHOrder 转换上交所逐笔委托, 委托号为 OrderOriNo:
+OrderKindAdd 为新增, Volume 是主动成交后剩余挂单的数量, 按限价挂在委托价上; OrderKindDel 为撤单;
+其它(如产品状态)没有对应的事件, 返回 false
+*/
+func NormalizeSHOrder(o *datatype.Order) (Event, bool) {
+	e := Event{
+		StockID: o.StockID,
+		Time:    o.Time,
+		Channel: o.Channel,
+		Seq:     shSeq(o.BizIndex, o.Order),
+		ID:      shOrderID(o),
+		Side:    SideOf(o.FunctionCode),
+		Volume:  volumeOf(o.Volume),
+		Offset:  -1,
+	}
+	switch o.OrderKind {
+	case datatype.OrderKindAdd:
+		e.Kind, e.OrderKind, e.Price = EventAdd, datatype.OrderKindFix, o.Price
+	case datatype.OrderKindDel:
+		e.Kind = EventCancel
+	default:
+		return Event{}, false
+	}
+	return e, true
+}
+
+// NormalizeSHTransaction 转换上交所逐笔成交, BidOrder/AskOrder 为双方的 OrderOriNo; 上交所的撤单不在成交中
+func NormalizeSHTransaction(t *datatype.Transaction) (Event, bool) {
+	if t.FunctionCode == datatype.TransactionFuncCancel {
+		return Event{}, false
+	}
+	return Event{
+		Kind:    EventFill,
+		StockID: t.StockID,
+		Time:    t.Time,
+		Channel: t.Channel,
+		Seq:     shSeq(t.BizIndex, t.Index),
+		Price:   t.Price,
+		Volume:  int64(t.Volume),
+		BidID:   int64(t.BidOrder),
+		AskID:   int64(t.AskOrder),
+		Offset:  -1,
+	}, true
+}
+
+func isSH(stockID string) bool {
+	return strings.HasSuffix(stockID, ".SH")
+}
+
+// NormalizeOrder 按 StockID 的后缀选择交易所, .SH 以外按深交所处理
+func NormalizeOrder(o *datatype.Order) (Event, bool) {
+	if isSH(o.StockID) {
+		return NormalizeSHOrder(o)
+	}
+	return NormalizeSZOrder(o)
+}
+
+func NormalizeTransaction(t *datatype.Transaction) (Event, bool) {
+	if isSH(t.StockID) {
+		return NormalizeSHTransaction(t)
+	}
+	return NormalizeSZTransaction(t)
+}
+
+// Normalize 转换一条逐笔委托或成交并带上 meta 中的 offset, 其它数据返回 false
+func Normalize(md *datatype.MD, meta *datatype.Meta) (Event, bool) {
+	var e Event
+	var ok bool
+	switch d := md.Data.(type) {
+	case *datatype.Order:
+		e, ok = NormalizeOrder(d)
+	case *datatype.Transaction:
+		e, ok = NormalizeTransaction(d)
+	}
+	if ok && meta != nil {
+		e.Offset = meta.Offset
+	}
+	return e, ok
+}
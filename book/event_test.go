@@ -0,0 +1,132 @@
+package book
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/codec"
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+// load 按行解码 testdata 中的数据
+func load(t *testing.T, file string) []*datatype.MD {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("open %s: %s", file, err)
+	}
+	defer f.Close()
+
+	var mds []*datatype.MD
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		md := &datatype.MD{}
+		if err := codec.JSON.Decode(scanner.Bytes(), md); err != nil {
+			t.Fatalf("decode %s:%d: %s", file, len(mds)+1, err)
+		}
+		mds = append(mds, md)
+	}
+	return mds
+}
+
+// replay 把 file 中的数据交给 Books, 返回转换出的事件, offset 为行号
+func replay(t *testing.T, file string, bs *Books) []Event {
+	var events []Event
+	for i, md := range load(t, file) {
+		meta := &datatype.Meta{Offset: int64(i)}
+		if e, ok := Normalize(md, meta); ok {
+			events = append(events, e)
+		}
+		bs.OnMD(md, meta)
+	}
+	return events
+}
+
+func kinds(events []Event) string {
+	ss := make([]string, len(events))
+	for i, e := range events {
+		ss[i] = fmt.Sprintf("%s:%d", e.Kind, e.Offset)
+	}
+	return strings.Join(ss, " ")
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		file    string
+		stockID string
+		events  string
+		bids    string
+		asks    string
+		volume  int64
+	}{
+		{
+			// 深交所: 撤单在逐笔成交中, 市价委托, 本方最优
+			file:    "testdata/sz.jsonl",
+			stockID: "000001.SZ",
+			events:  "add:0 add:1 add:2 add:3 fill:4 add:5 fill:6 fill:7 cancel:8 add:9 add:10",
+			bids:    "[{11.3 300 1}]",
+			asks:    "[{11.38 450 2}]",
+			volume:  300,
+		},
+		{
+			// 上交所: 主动成交先于新增委托到达, 新增委托只含剩余数量, 撤单在委托流中, 产品状态被忽略
+			file:    "testdata/sh.jsonl",
+			stockID: "600000.SH",
+			events:  "add:0 add:1 add:2 add:3 fill:4 fill:5 fill:6 add:7 cancel:8 cancel:9",
+			bids:    "[{10.02 200 1}]",
+			asks:    "[{10.03 500 1}]",
+			volume:  1000,
+		},
+	}
+
+	for _, tt := range tests {
+		bs := NewBooks()
+		events := replay(t, tt.file, bs)
+		if got := kinds(events); got != tt.events {
+			t.Errorf("%s events = %s", tt.file, got)
+		}
+
+		b, ok := bs.Book(tt.stockID)
+		if !ok {
+			t.Errorf("%s no book for %s", tt.file, tt.stockID)
+			continue
+		}
+		bids, asks := b.Depth(0)
+		if got := fmt.Sprint(bids); got != tt.bids {
+			t.Errorf("%s bids = %s", tt.file, got)
+		}
+		if got := fmt.Sprint(asks); got != tt.asks {
+			t.Errorf("%s asks = %s", tt.file, got)
+		}
+		if _, volume, _ := b.Trade(); volume != tt.volume {
+			t.Errorf("%s volume = %d", tt.file, volume)
+		}
+	}
+}
+
+func TestModify(t *testing.T) {
+	b := NewBook("000001.SZ")
+	b.Add(1, Bid, datatype.OrderKindFix, 10, 100, 93000000)
+	b.Add(2, Bid, datatype.OrderKindFix, 10, 200, 93000001)
+
+	// 只减少数量时保持时间优先
+	b.Apply(Event{Kind: EventModify, ID: 1, Price: 10, Volume: 50})
+	if pos, _ := b.QueuePosition(2); pos.Orders != 1 || pos.Volume != 50 {
+		t.Errorf("position of 2 = %+v", pos)
+	}
+
+	// 增加数量排到末尾
+	b.Apply(Event{Kind: EventModify, ID: 1, Price: 10, Volume: 150})
+	if pos, _ := b.QueuePosition(1); pos.Orders != 1 || pos.Volume != 200 {
+		t.Errorf("position of 1 = %+v", pos)
+	}
+
+	// 改价
+	b.Apply(Event{Kind: EventModify, ID: 2, Price: 10.01, Volume: 200})
+	bids, _ := b.Depth(0)
+	if got := fmt.Sprint(bids); got != "[{10.01 200 1} {10 150 1}]" {
+		t.Errorf("bids = %s", got)
+	}
+}
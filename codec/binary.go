@@ -0,0 +1,344 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+/*
+Binary 是紧凑的二进制编码: 第 1 个字节为版本号 binaryVersion, 第 2 个字节为 datatype.TypeXXX,
+之后按结构体字段顺序依次写入, 整数为 zigzag varint, 浮点数为 8 字节小端 float64,
+字符串为 uvarint 长度加内容, []float64 为 uvarint 个数加各元素. 所有类型的第一个字段都是 StockID
+*/
+var Binary Codec = binaryCodec{}
+
+const binaryVersion = 1
+
+var errShortBuffer = errors.New("short buffer")
+
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string {
+	return "binary"
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *encoder) float(v float64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *encoder) string(s string) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) floats(v []float64) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	for _, f := range v {
+		e.float(f)
+	}
+}
+
+// decoder 遇到第一个错误后不再读取, 由调用方最后检查 err
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) float() float64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.buf) < 8 {
+		d.err = errShortBuffer
+		return 0
+	}
+	v := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+	d.buf = d.buf[8:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uint()
+	if d.err != nil {
+		return ""
+	}
+	if uint64(len(d.buf)) < n {
+		d.err = errShortBuffer
+		return ""
+	}
+	s := intern(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+// floats 追加到 dst[:0], dst 容量足够时不分配内存
+func (d *decoder) floats(dst []float64) []float64 {
+	n := d.uint()
+	if d.err != nil {
+		return dst
+	}
+	// 先除后比较, 避免很大的 n 使 n*8 溢出
+	if n > uint64(len(d.buf))/8 {
+		d.err = errShortBuffer
+		return dst
+	}
+	if dst == nil {
+		dst = make([]float64, 0, n)
+	}
+	dst = dst[:0]
+	for i := uint64(0); i < n; i++ {
+		dst = append(dst, d.float())
+	}
+	return dst
+}
+
+// skipString 跳过一个字符串字段
+func (d *decoder) skipString() {
+	n := d.uint()
+	if d.err == nil && uint64(len(d.buf)) >= n {
+		d.buf = d.buf[n:]
+	} else if d.err == nil {
+		d.err = errShortBuffer
+	}
+}
+
+func (binaryCodec) Encode(md *datatype.MD) ([]byte, error) {
+	typ := TypeOf(md.Data)
+	if typ == datatype.TypeUnknown {
+		return nil, fmt.Errorf("unknown data type(%T)", md.Data)
+	}
+
+	e := &encoder{buf: make([]byte, 0, 256)}
+	e.buf = append(e.buf, binaryVersion, byte(typ))
+
+	switch d := md.Data.(type) {
+	case *datatype.Snapshot:
+		e.string(d.StockID)
+		e.int(int64(d.TradingDay))
+		e.int(int64(d.Time))
+		e.string(d.Status)
+		e.float(d.PrevClose)
+		e.float(d.Open)
+		e.float(d.High)
+		e.float(d.Low)
+		e.float(d.Match)
+		e.floats(d.AskPrices)
+		e.floats(d.AskVolumes)
+		e.floats(d.BidPrices)
+		e.floats(d.BidVolumes)
+		e.int(int64(d.TradesNum))
+		e.int(d.Volume)
+		e.int(d.Turnover)
+		e.int(d.TotalAskVolume)
+		e.int(d.TotalBidVolume)
+		e.float(d.WeightedAvgAskPrice)
+		e.float(d.WeightedAvgBidPrice)
+		e.int(int64(d.IOPV))
+		e.float(d.HighLimited)
+		e.float(d.LowLimited)
+	case *datatype.Order:
+		e.string(d.StockID)
+		e.int(int64(d.ActionDay))
+		e.int(int64(d.Time))
+		e.int(int64(d.Order))
+		e.float(d.Price)
+		e.float(d.Volume)
+		e.string(d.OrderKind)
+		e.string(d.FunctionCode)
+		e.int(int64(d.Channel))
+		e.int(d.OrderOriNo)
+		e.int(d.BizIndex)
+	case *datatype.Transaction:
+		e.string(d.StockID)
+		e.int(int64(d.ActionDay))
+		e.int(int64(d.Time))
+		e.int(int64(d.Index))
+		e.float(d.Price)
+		e.int(int64(d.Volume))
+		e.int(d.Turnover)
+		e.string(d.Bsflag)
+		e.string(d.OrderKind)
+		e.string(d.FunctionCode)
+		e.int(int64(d.AskOrder))
+		e.int(int64(d.BidOrder))
+		e.int(int64(d.Channel))
+		e.int(d.BizIndex)
+	case *datatype.Index:
+		e.string(d.StockID)
+		e.string(d.SZCode)
+		e.int(int64(d.ActionDay))
+		e.int(int64(d.TradingDay))
+		e.int(int64(d.Time))
+		e.float(d.PrevClose)
+		e.float(d.Open)
+		e.float(d.High)
+		e.float(d.Low)
+		e.float(d.Match)
+		e.int(d.Volume)
+		e.int(d.Turnover)
+	}
+	return e.buf, nil
+}
+
+func header(value []byte) (int, error) {
+	if len(value) < 2 {
+		return datatype.TypeUnknown, errShortBuffer
+	}
+	if value[0] != binaryVersion {
+		return datatype.TypeUnknown, fmt.Errorf("unknown binary version(%d)", value[0])
+	}
+	return int(value[1]), nil
+}
+
+func (binaryCodec) Decode(value []byte, md *datatype.MD) error {
+	typ, err := header(value)
+	if err != nil {
+		return err
+	}
+	md.Type = typ
+	if md.Data == nil {
+		md.Data = NewData(typ)
+	}
+	if TypeOf(md.Data) != typ {
+		// 类型不一致时不解码数据, 由调用方根据 md.Type 判断
+		return nil
+	}
+
+	d := &decoder{buf: value[2:]}
+	switch v := md.Data.(type) {
+	case *datatype.Snapshot:
+		v.StockID = d.string()
+		v.TradingDay = int(d.int())
+		v.Time = int(d.int())
+		v.Status = d.string()
+		v.PrevClose = d.float()
+		v.Open = d.float()
+		v.High = d.float()
+		v.Low = d.float()
+		v.Match = d.float()
+		v.AskPrices = d.floats(v.AskPrices)
+		v.AskVolumes = d.floats(v.AskVolumes)
+		v.BidPrices = d.floats(v.BidPrices)
+		v.BidVolumes = d.floats(v.BidVolumes)
+		v.TradesNum = int(d.int())
+		v.Volume = d.int()
+		v.Turnover = d.int()
+		v.TotalAskVolume = d.int()
+		v.TotalBidVolume = d.int()
+		v.WeightedAvgAskPrice = d.float()
+		v.WeightedAvgBidPrice = d.float()
+		v.IOPV = int(d.int())
+		v.HighLimited = d.float()
+		v.LowLimited = d.float()
+	case *datatype.Order:
+		v.StockID = d.string()
+		v.ActionDay = int(d.int())
+		v.Time = int(d.int())
+		v.Order = int(d.int())
+		v.Price = d.float()
+		v.Volume = d.float()
+		v.OrderKind = d.string()
+		v.FunctionCode = d.string()
+		v.Channel = int(d.int())
+		v.OrderOriNo = d.int()
+		v.BizIndex = d.int()
+	case *datatype.Transaction:
+		v.StockID = d.string()
+		v.ActionDay = int(d.int())
+		v.Time = int(d.int())
+		v.Index = int(d.int())
+		v.Price = d.float()
+		v.Volume = int(d.int())
+		v.Turnover = d.int()
+		v.Bsflag = d.string()
+		v.OrderKind = d.string()
+		v.FunctionCode = d.string()
+		v.AskOrder = int(d.int())
+		v.BidOrder = int(d.int())
+		v.Channel = int(d.int())
+		v.BizIndex = d.int()
+	case *datatype.Index:
+		v.StockID = d.string()
+		v.SZCode = d.string()
+		v.ActionDay = int(d.int())
+		v.TradingDay = int(d.int())
+		v.Time = int(d.int())
+		v.PrevClose = d.float()
+		v.Open = d.float()
+		v.High = d.float()
+		v.Low = d.float()
+		v.Match = d.float()
+		v.Volume = d.int()
+		v.Turnover = d.int()
+	}
+	return d.err
+}
+
+func (binaryCodec) StockID(value []byte) (string, bool) {
+	if _, err := header(value); err != nil {
+		return "", false
+	}
+	d := &decoder{buf: value[2:]}
+	stockID := d.string()
+	return stockID, d.err == nil
+}
+
+func (binaryCodec) Time(value []byte) (int, bool) {
+	typ, err := header(value)
+	if err != nil {
+		return 0, false
+	}
+
+	d := &decoder{buf: value[2:]}
+	d.skipString() // StockID
+	switch typ {
+	case datatype.TypeSnapshot, datatype.TypeOrder, datatype.TypeTransaction:
+		d.int() // TradingDay/ActionDay
+	case datatype.TypeIndex:
+		d.skipString() // SZCode
+		d.int()        // ActionDay
+		d.int()        // TradingDay
+	default:
+		return 0, false
+	}
+	t := int(d.int())
+	return t, d.err == nil
+}
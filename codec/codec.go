@@ -0,0 +1,96 @@
+package codec
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// Header 是指定消息体编码的 kafka header, 值为 Codec.Name(), 如 "binary"
+const Header = "codec"
+
+/*
+Codec 负责消息体与 datatype.MD 之间的转换. Decode 时 md.Data 可以预先设置为
+*datatype.Snapshot 等具体类型的指针, 此时解码到该对象中; 为 nil 时按消息中的类型新建.
+解码后的 md.Type 为消息中的类型, 与 md.Data 的类型不一致时由调用方判断
+*/
+type Codec interface {
+	Name() string
+	Encode(md *datatype.MD) ([]byte, error)
+	Decode(value []byte, md *datatype.MD) error
+
+	// StockID 与 Time 不做完整解析, 只取出代码与交易所时间(HHMMSSmmm), 用于过滤/分片/回放
+	StockID(value []byte) (string, bool)
+	Time(value []byte) (int, bool)
+}
+
+var (
+	mtx    sync.RWMutex
+	codecs = map[string]Codec{
+		JSON.Name():   JSON,
+		Binary.Name(): Binary,
+	}
+)
+
+// Register 注册自定义 Codec, 之后可通过 Header 选用
+func Register(c Codec) {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	codecs[c.Name()] = c
+}
+
+func Lookup(name string) (Codec, bool) {
+	mtx.RLock()
+	defer mtx.RUnlock()
+
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// FromHeader 返回消息 Header 指定的 Codec, 没有该 header 时第二个返回值为 false
+func FromHeader(m *kafkago.Message) (Codec, bool, error) {
+	for _, h := range m.Headers {
+		if h.Key != Header {
+			continue
+		}
+		c, ok := Lookup(string(h.Value))
+		if !ok {
+			return nil, true, fmt.Errorf("unknown codec(%s)", h.Value)
+		}
+		return c, true, nil
+	}
+	return nil, false, nil
+}
+
+// NewData 返回 typ 对应的数据对象, 未知类型返回 nil
+func NewData(typ int) interface{} {
+	switch typ {
+	case datatype.TypeSnapshot:
+		return &datatype.Snapshot{}
+	case datatype.TypeOrder:
+		return &datatype.Order{}
+	case datatype.TypeTransaction:
+		return &datatype.Transaction{}
+	case datatype.TypeIndex:
+		return &datatype.Index{}
+	}
+	return nil
+}
+
+// TypeOf 返回数据对象对应的 datatype.TypeXXX
+func TypeOf(data interface{}) int {
+	switch data.(type) {
+	case *datatype.Snapshot:
+		return datatype.TypeSnapshot
+	case *datatype.Order:
+		return datatype.TypeOrder
+	case *datatype.Transaction:
+		return datatype.TypeTransaction
+	case *datatype.Index:
+		return datatype.TypeIndex
+	}
+	return datatype.TypeUnknown
+}
@@ -0,0 +1,237 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const testSnapshot = `{"type":1,"data":{"stock_id":"000001.SZ","trading_day":20230823,"time":92018000,"status":"I","prevclose":11.37,"ask_prices":[11.37,0.0],"ask_volumes":[9.79,0.0],"bid_prices":[11.37,0.0],"bid_volumes":[9.79,0.9],"high_limited":12.51,"low_limited":10.23}}`
+
+func TestBinaryRoundTrip(t *testing.T) {
+	snapshot := &datatype.Snapshot{}
+	if err := JSON.Decode([]byte(testSnapshot), &datatype.MD{Data: snapshot}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []interface{}{
+		snapshot,
+		&datatype.Order{StockID: "600000.SH", ActionDay: 20230823, Time: 93000010, Order: 12, Price: 7.25, Volume: 300, OrderKind: "A", FunctionCode: "B", Channel: 6, BizIndex: 1001},
+		&datatype.Transaction{StockID: "000001.SZ", Time: 93000020, Index: 13, Price: 11.37, Volume: 100, FunctionCode: "0", AskOrder: 12, BidOrder: 10, Channel: 2011},
+		&datatype.Index{StockID: "000300.SH", SZCode: "000300", TradingDay: 20230823, Time: 93000000, Match: 3800.5, Volume: -1},
+	} {
+		value, err := Binary.Encode(&datatype.MD{Type: TypeOf(data), Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		md := &datatype.MD{}
+		if err := Binary.Decode(value, md); err != nil {
+			t.Fatalf("decode %T error: %s", data, err)
+		}
+		if md.Type != TypeOf(data) || !reflect.DeepEqual(md.Data, data) {
+			t.Errorf("decoded %+v, want %+v", md.Data, data)
+		}
+
+		stockID, _ := Binary.StockID(value)
+		mdTime, _ := Binary.Time(value)
+		if want := reflect.ValueOf(data).Elem(); stockID != want.FieldByName("StockID").String() || int64(mdTime) != want.FieldByName("Time").Int() {
+			t.Errorf("peek %T = %s %d", data, stockID, mdTime)
+		}
+		t.Logf("%T: binary %d bytes", data, len(value))
+	}
+}
+
+func TestBinaryTypeMismatch(t *testing.T) {
+	value, _ := Binary.Encode(&datatype.MD{Data: &datatype.Order{StockID: "000001.SZ"}})
+
+	md := &datatype.MD{Data: &datatype.Snapshot{}}
+	if err := Binary.Decode(value, md); err != nil {
+		t.Fatal(err)
+	}
+	if md.Type != datatype.TypeOrder {
+		t.Errorf("type = %d, want %d", md.Type, datatype.TypeOrder)
+	}
+
+	if err := Binary.Decode(value[:5], &datatype.MD{}); err == nil {
+		t.Errorf("decode truncated value: want error")
+	}
+}
+
+// newSnapshot 返回各档位切片容量为 MaxLevels 的 Snapshot, 与复用时的对象相同
+func newSnapshot() *datatype.Snapshot {
+	return resetSnapshot(&datatype.Snapshot{
+		AskPrices:  make([]float64, 0, datatype.MaxLevels),
+		AskVolumes: make([]float64, 0, datatype.MaxLevels),
+		BidPrices:  make([]float64, 0, datatype.MaxLevels),
+		BidVolumes: make([]float64, 0, datatype.MaxLevels),
+	})
+}
+
+func resetSnapshot(s *datatype.Snapshot) *datatype.Snapshot {
+	*s = datatype.Snapshot{AskPrices: s.AskPrices[:0], AskVolumes: s.AskVolumes[:0], BidPrices: s.BidPrices[:0], BidVolumes: s.BidVolumes[:0]}
+	return s
+}
+
+// binaryValues 返回各类型的编码结果, 作为截断与 fuzz 的输入
+func binaryValues(t testing.TB) [][]byte {
+	var values [][]byte
+	for _, data := range []interface{}{
+		&datatype.Snapshot{StockID: "000001.SZ", Time: 93000000, AskPrices: []float64{11.37, 11.38}, BidVolumes: []float64{100}},
+		&datatype.Order{StockID: "600000.SH", Time: 93000010, Order: 12, OrderKind: "A"},
+		&datatype.Transaction{StockID: "000001.SZ", Time: 93000020, Index: 13},
+		&datatype.Index{StockID: "000300.SH", SZCode: "000300", Time: 93000000},
+	} {
+		value, err := Binary.Encode(&datatype.MD{Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// decodeBinary 对任意输入调用 Decode/StockID/Time, 只要求不 panic
+func decodeBinary(value []byte) error {
+	Binary.StockID(value)
+	Binary.Time(value)
+	if err := Binary.Decode(value, &datatype.MD{}); err != nil {
+		return err
+	}
+	return Binary.Decode(value, &datatype.MD{Data: newSnapshot()})
+}
+
+func TestBinaryMalformed(t *testing.T) {
+	for _, value := range binaryValues(t) {
+		for n := 0; n < len(value); n++ {
+			if err := decodeBinary(value[:n]); err == nil && n > 2 {
+				t.Errorf("decode %d of %d bytes: want error", n, len(value))
+			}
+		}
+	}
+
+	// AskPrices 的个数为 2^63, n*8 会溢出
+	value := []byte{binaryVersion, datatype.TypeSnapshot}
+	value = binary.AppendUvarint(value, 9)
+	value = append(value, "000001.SZ"...)
+	value = binary.AppendVarint(value, 20230823)
+	value = binary.AppendVarint(value, 93000000)
+	value = binary.AppendUvarint(value, 0)
+	value = append(value, make([]byte, 5*8)...)
+	value = binary.AppendUvarint(value, 1<<63)
+	if err := decodeBinary(value); err == nil {
+		t.Errorf("decode huge count: want error")
+	}
+}
+
+func FuzzBinary(f *testing.F) {
+	for _, value := range binaryValues(f) {
+		f.Add(value)
+	}
+	f.Fuzz(func(t *testing.T, value []byte) {
+		decodeBinary(value)
+	})
+}
+
+func TestJSONPeek(t *testing.T) {
+	for value, want := range map[string]string{
+		testSnapshot:                           "000001.SZ",
+		`{"data": {"stock_id" : "600000.SH"}}`: "600000.SH",
+		`{"data":{"time":93000000}}`:           "",
+	} {
+		if got, _ := JSON.StockID([]byte(value)); got != want {
+			t.Errorf("StockID(%s) = %q, want %q", value, got, want)
+		}
+	}
+
+	if mdTime, _ := JSON.Time([]byte(testSnapshot)); mdTime != 92018000 {
+		t.Errorf("Time = %d, want 92018000", mdTime)
+	}
+}
+
+func TestFromHeader(t *testing.T) {
+	m := &kafkago.Message{Headers: []kafkago.Header{{Key: Header, Value: []byte("binary")}}}
+	if cd, ok, err := FromHeader(m); !ok || err != nil || cd != Binary {
+		t.Errorf("FromHeader = %v, %v, %v", cd, ok, err)
+	}
+
+	m.Headers[0].Value = []byte("msgpack")
+	if _, ok, err := FromHeader(m); !ok || err == nil {
+		t.Errorf("FromHeader(msgpack) = %v, %v, want error", ok, err)
+	}
+}
+
+func TestJSONDecodeMatchesStd(t *testing.T) {
+	for _, value := range []string{
+		testSnapshot,
+		`{"type":1,"data":{"stock_id":"000001.SZ","trades_num":12,"extra":{"a":[1,"x\"y",{}]},"flag":true,"volume":100}}`,
+		`{"data":{"stock_id":"000001.SZ","time":93000000,"ask_prices":[]},"type":1}`,
+		`{"type":1,"data":{"stock_id":"000\u0030001.SZ"}}`,             // 转义
+		`{"type":1,"data":{"stock_id":"000001.SZ","ask_prices":null}}`, // null
+		`{"type":1,"data":{"stock_id":"000001.SZ","volume":1.5}}`,      // 整数字段中的小数, encoding/json 报错
+		`{"type":1,"data":{"stock_id":"000001.SZ","open":01}}`,         // 非法数字
+		`{"type":1,"data":{"stock_id":"000001.SZ"}`,                    // 不完整
+		`{"type":1,"data":{"stock_id":"000001.SZ","ask_prices":[1,2,3,4,5,6,7,8,9,10,11,12]}}`,
+		`{"type":1,"data":{"Stock_ID":"000001.SZ","VOLUME":100}}`,   // 大小写不同
+		`{"Type":1,"DATA":{"stock_id":"000001.SZ"}}`,                // 大小写不同
+		`{"type":1,"data":{"stocK_id":"x","stock_id":"000001.SZ"}}`, // 非 ASCII
+	} {
+		want := newSnapshot()
+		wantErr := json.Unmarshal([]byte(value), &datatype.MD{Data: want})
+
+		got := newSnapshot()
+		gotErr := JSON.Decode([]byte(value), &datatype.MD{Data: got})
+
+		if (gotErr != nil) != (wantErr != nil) {
+			t.Errorf("%s: error = %v, want %v", value, gotErr, wantErr)
+			continue
+		}
+		if wantErr == nil && !reflect.DeepEqual(got.Clone(), want.Clone()) {
+			t.Errorf("%s:\n got %+v\nwant %+v", value, *got, *want)
+		}
+	}
+}
+
+// TestJSONKeys 检查 jsondec 的字段名列表与 datatype 的 json tag 一致
+func TestJSONKeys(t *testing.T) {
+	for _, tt := range []struct {
+		data interface{}
+		keys []string
+	}{
+		{datatype.Snapshot{}, snapshotKeys},
+		{datatype.Order{}, orderKeys},
+		{datatype.Transaction{}, transactionKeys},
+		{datatype.Index{}, indexKeys},
+	} {
+		typ := reflect.TypeOf(tt.data)
+		var tags []string
+		for i := 0; i < typ.NumField(); i++ {
+			if tag := typ.Field(i).Tag.Get("json"); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		if !reflect.DeepEqual(tags, tt.keys) {
+			t.Errorf("%s keys = %v, want %v", typ.Name(), tt.keys, tags)
+		}
+	}
+}
+
+func TestJSONDecodeAllocs(t *testing.T) {
+	value := []byte(testSnapshot)
+	snapshot := newSnapshot()
+	md := &datatype.MD{Data: snapshot}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		resetSnapshot(snapshot)
+		if err := JSON.Decode(value, md); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("allocs = %.1f, want 0", allocs)
+	}
+}
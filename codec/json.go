@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+// JSON 是默认编码: {"type":1,"data":{"stock_id":"000001.SZ",...}}
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+type jsonEnvelope struct {
+	Type int         `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Encode(md *datatype.MD) ([]byte, error) {
+	return json.Marshal(&jsonEnvelope{Type: md.Type, Data: md.Data})
+}
+
+func (jsonCodec) Decode(value []byte, md *datatype.MD) error {
+	if md.Data != nil {
+		if err := decodeJSON(value, md); err == nil {
+			return nil
+		}
+		return json.Unmarshal(value, md)
+	}
+
+	envelope := struct {
+		Type int             `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(value, &envelope); err != nil {
+		return err
+	}
+	md.Type = envelope.Type
+	if md.Data = NewData(envelope.Type); md.Data == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, md.Data)
+}
+
+var stockIDKey = []byte(`"stock_id"`)
+
+func (jsonCodec) StockID(value []byte) (string, bool) {
+	i := bytes.Index(value, stockIDKey)
+	if i < 0 {
+		return "", false
+	}
+	rest := value[i+len(stockIDKey):]
+
+	// 跳过 ':' 及其前后的空白
+	j := 0
+	for j < len(rest) && (rest[j] == ' ' || rest[j] == ':' || rest[j] == '\t') {
+		j++
+	}
+	if j >= len(rest) || rest[j] != '"' {
+		return "", false
+	}
+	rest = rest[j+1:]
+
+	end := bytes.IndexByte(rest, '"')
+	if end < 0 {
+		return "", false
+	}
+	return string(rest[:end]), true
+}
+
+func (jsonCodec) Time(value []byte) (int, bool) {
+	envelope := struct {
+		Data struct {
+			Time int `json:"time"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(value, &envelope); err != nil || envelope.Data.Time == 0 {
+		return 0, false
+	}
+	return envelope.Data.Time, true
+}
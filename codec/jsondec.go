@@ -0,0 +1,572 @@
+package codec
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+/*
+手写的 JSON 解码, 只处理已知结构, 解码到已有对象中且不分配内存:
+只识别与 json tag 完全相同的字段名; encoding/json 不区分大小写, 因此与已知字段只有大小写不同或含非 ASCII 字符的字段名,
+以及转义字符串, null, 整数字段中的小数等不常见的写法都返回 errFallback, 由 JSON.Decode 交给 encoding/json 处理,
+其余未知字段跳过, 因此结果与 encoding/json 一致
+*/
+
+var errFallback = errors.New("fallback to encoding/json")
+
+// MaxInterned 是 intern 表的上限, 超过后新出现的字符串不再缓存
+const MaxInterned = 1 << 16
+
+var (
+	internMtx sync.RWMutex
+	interned  = make(map[string]string)
+)
+
+// intern 返回与 b 内容相同的字符串, 代码/状态等取值有限的字段因此不必每次分配
+func intern(b []byte) string {
+	internMtx.RLock()
+	s, ok := interned[string(b)]
+	internMtx.RUnlock()
+	if ok {
+		return s
+	}
+
+	s = string(b)
+	internMtx.Lock()
+	if len(interned) < MaxInterned {
+		interned[s] = s
+	}
+	internMtx.Unlock()
+	return s
+}
+
+type scanner struct {
+	buf []byte
+	pos int
+}
+
+func (s *scanner) ws() {
+	for s.pos < len(s.buf) {
+		switch s.buf[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) peek() byte {
+	s.ws()
+	if s.pos >= len(s.buf) {
+		return 0
+	}
+	return s.buf[s.pos]
+}
+
+func (s *scanner) expect(c byte) error {
+	if s.peek() != c {
+		return errFallback
+	}
+	s.pos++
+	return nil
+}
+
+// str 返回不含转义的字符串内容, 与 buf 共享内存
+func (s *scanner) str() ([]byte, error) {
+	if err := s.expect('"'); err != nil {
+		return nil, err
+	}
+	start := s.pos
+	for s.pos < len(s.buf) {
+		switch c := s.buf[s.pos]; {
+		case c == '"':
+			s.pos++
+			return s.buf[start : s.pos-1], nil
+		case c == '\\' || c < 0x20:
+			return nil, errFallback
+		}
+		s.pos++
+	}
+	return nil, errFallback
+}
+
+func (s *scanner) string() (string, error) {
+	b, err := s.str()
+	if err != nil {
+		return "", err
+	}
+	return intern(b), nil
+}
+
+// number 返回数字的原始内容
+func (s *scanner) number() ([]byte, error) {
+	s.ws()
+	start := s.pos
+	for s.pos < len(s.buf) {
+		c := s.buf[s.pos]
+		if (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E' {
+			s.pos++
+			continue
+		}
+		break
+	}
+	if !validNumber(s.buf[start:s.pos]) {
+		return nil, errFallback
+	}
+	return s.buf[start:s.pos], nil
+}
+
+// validNumber 检查 b 符合 JSON 的数字语法, strconv 接受的 +1, .5, 01 等写法交给 encoding/json 报错
+func validNumber(b []byte) bool {
+	i := 0
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+	digits := func() int {
+		start := i
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+		return i - start
+	}
+
+	start := i
+	if n := digits(); n == 0 || (n > 1 && b[start] == '0') {
+		return false
+	}
+	if i < len(b) && b[i] == '.' {
+		i++
+		if digits() == 0 {
+			return false
+		}
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return i == len(b)
+}
+
+func (s *scanner) int() (int64, error) {
+	b, err := s.number()
+	if err != nil {
+		return 0, err
+	}
+
+	neg := b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	if len(b) == 0 || len(b) > 18 {
+		return 0, errFallback
+	}
+	var v int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, errFallback
+		}
+		v = v*10 + int64(c-'0')
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func (s *scanner) float() (float64, error) {
+	b, err := s.number()
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return 0, errFallback
+	}
+	return v, nil
+}
+
+// floats 追加到 dst[:0], dst 容量足够时不分配内存
+func (s *scanner) floats(dst []float64) ([]float64, error) {
+	if err := s.expect('['); err != nil {
+		return dst, err
+	}
+	if dst == nil {
+		dst = make([]float64, 0, datatype.MaxLevels)
+	}
+	dst = dst[:0]
+	if s.peek() == ']' {
+		s.pos++
+		return dst, nil
+	}
+	for {
+		v, err := s.float()
+		if err != nil {
+			return dst, err
+		}
+		dst = append(dst, v)
+
+		switch s.peek() {
+		case ',':
+			s.pos++
+		case ']':
+			s.pos++
+			return dst, nil
+		default:
+			return dst, errFallback
+		}
+	}
+}
+
+// skip 跳过任意一个值
+func (s *scanner) skip() error {
+	switch c := s.peek(); {
+	case c == '"':
+		// 跳过的字符串允许转义
+		s.pos++
+		for s.pos < len(s.buf) {
+			switch s.buf[s.pos] {
+			case '\\':
+				s.pos += 2
+				continue
+			case '"':
+				s.pos++
+				return nil
+			}
+			s.pos++
+		}
+		return errFallback
+	case c == '{' || c == '[':
+		s.pos++
+		depth := 1
+		for depth > 0 {
+			switch s.peek() {
+			case '{', '[':
+				depth++
+				s.pos++
+			case '}', ']':
+				depth--
+				s.pos++
+			case '"':
+				if err := s.skip(); err != nil {
+					return err
+				}
+			case 0:
+				return errFallback
+			default:
+				s.pos++
+			}
+		}
+		return nil
+	case c == 't' || c == 'f' || c == 'n':
+		for s.pos < len(s.buf) && s.buf[s.pos] >= 'a' && s.buf[s.pos] <= 'z' {
+			s.pos++
+		}
+		return nil
+	default:
+		_, err := s.number()
+		return err
+	}
+}
+
+// 各结构的字段名, 用于判断未知字段是否只是大小写不同
+var (
+	envelopeKeys    = []string{"type", "data"}
+	snapshotKeys    = []string{"stock_id", "trading_day", "time", "status", "prevclose", "open", "high", "low", "match", "ask_prices", "ask_volumes", "bid_prices", "bid_volumes", "trading_num", "volume", "turnover", "total_ask_volume", "total_bid_volume", "weighted_avg_ask_price", "weighted_avg_bid_price", "iopv", "high_limited", "low_limited"}
+	orderKeys       = []string{"stock_id", "action_day", "time", "order", "price", "volume", "order_kind", "function_code", "channel", "order_ori_no", "biz_index"}
+	transactionKeys = []string{"stock_id", "action_day", "time", "index", "price", "volume", "turnover", "bsflag", "order_kind", "function_code", "ask_order", "bid_order", "channel", "biz_index"}
+	indexKeys       = []string{"stock_id", "sz_code", "action_day", "trading_day", "time", "prevclose", "open", "high", "low", "match", "volume", "turnover"}
+)
+
+// foldEqual 按 ASCII 不区分大小写比较
+func foldEqual(key []byte, name string) bool {
+	if len(key) != len(name) {
+		return false
+	}
+	for i, c := range key {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != name[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// unknown 跳过未知字段; 字段名与 known 中的某个只有大小写不同, 或含非 ASCII 字符(encoding/json 按 Unicode 规则折叠)时返回 errFallback
+func (s *scanner) unknown(key []byte, known []string) error {
+	for _, c := range key {
+		if c >= 0x80 {
+			return errFallback
+		}
+	}
+	for _, name := range known {
+		if foldEqual(key, name) {
+			return errFallback
+		}
+	}
+	return s.skip()
+}
+
+// object 依次对每个字段调用 field, field 负责读取字段值
+func (s *scanner) object(field func(key []byte) error) error {
+	if err := s.expect('{'); err != nil {
+		return err
+	}
+	if s.peek() == '}' {
+		s.pos++
+		return nil
+	}
+	for {
+		key, err := s.str()
+		if err != nil {
+			return err
+		}
+		if err := s.expect(':'); err != nil {
+			return err
+		}
+		// null 交给 encoding/json 处理
+		if s.peek() == 'n' {
+			return errFallback
+		}
+		if err := field(key); err != nil {
+			return err
+		}
+
+		switch s.peek() {
+		case ',':
+			s.pos++
+		case '}':
+			s.pos++
+			return nil
+		default:
+			return errFallback
+		}
+	}
+}
+
+func decodeJSON(value []byte, md *datatype.MD) error {
+	s := &scanner{buf: value}
+	err := s.object(func(key []byte) (err error) {
+		switch string(key) {
+		case "type":
+			var typ int64
+			typ, err = s.int()
+			md.Type = int(typ)
+		case "data":
+			switch d := md.Data.(type) {
+			case *datatype.Snapshot:
+				err = s.snapshot(d)
+			case *datatype.Order:
+				err = s.order(d)
+			case *datatype.Transaction:
+				err = s.transaction(d)
+			case *datatype.Index:
+				err = s.index(d)
+			default:
+				err = errFallback
+			}
+		default:
+			err = s.unknown(key, envelopeKeys)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if s.peek() != 0 {
+		return errFallback
+	}
+	return nil
+}
+
+func (s *scanner) snapshot(d *datatype.Snapshot) error {
+	return s.object(func(key []byte) (err error) {
+		var n int64
+		switch string(key) {
+		case "stock_id":
+			d.StockID, err = s.string()
+		case "trading_day":
+			n, err = s.int()
+			d.TradingDay = int(n)
+		case "time":
+			n, err = s.int()
+			d.Time = int(n)
+		case "status":
+			d.Status, err = s.string()
+		case "prevclose":
+			d.PrevClose, err = s.float()
+		case "open":
+			d.Open, err = s.float()
+		case "high":
+			d.High, err = s.float()
+		case "low":
+			d.Low, err = s.float()
+		case "match":
+			d.Match, err = s.float()
+		case "ask_prices":
+			d.AskPrices, err = s.floats(d.AskPrices)
+		case "ask_volumes":
+			d.AskVolumes, err = s.floats(d.AskVolumes)
+		case "bid_prices":
+			d.BidPrices, err = s.floats(d.BidPrices)
+		case "bid_volumes":
+			d.BidVolumes, err = s.floats(d.BidVolumes)
+		case "trading_num":
+			n, err = s.int()
+			d.TradesNum = int(n)
+		case "volume":
+			d.Volume, err = s.int()
+		case "turnover":
+			d.Turnover, err = s.int()
+		case "total_ask_volume":
+			d.TotalAskVolume, err = s.int()
+		case "total_bid_volume":
+			d.TotalBidVolume, err = s.int()
+		case "weighted_avg_ask_price":
+			d.WeightedAvgAskPrice, err = s.float()
+		case "weighted_avg_bid_price":
+			d.WeightedAvgBidPrice, err = s.float()
+		case "iopv":
+			n, err = s.int()
+			d.IOPV = int(n)
+		case "high_limited":
+			d.HighLimited, err = s.float()
+		case "low_limited":
+			d.LowLimited, err = s.float()
+		default:
+			err = s.unknown(key, snapshotKeys)
+		}
+		return err
+	})
+}
+
+func (s *scanner) order(d *datatype.Order) error {
+	return s.object(func(key []byte) (err error) {
+		var n int64
+		switch string(key) {
+		case "stock_id":
+			d.StockID, err = s.string()
+		case "action_day":
+			n, err = s.int()
+			d.ActionDay = int(n)
+		case "time":
+			n, err = s.int()
+			d.Time = int(n)
+		case "order":
+			n, err = s.int()
+			d.Order = int(n)
+		case "price":
+			d.Price, err = s.float()
+		case "volume":
+			d.Volume, err = s.float()
+		case "order_kind":
+			d.OrderKind, err = s.string()
+		case "function_code":
+			d.FunctionCode, err = s.string()
+		case "channel":
+			n, err = s.int()
+			d.Channel = int(n)
+		case "order_ori_no":
+			d.OrderOriNo, err = s.int()
+		case "biz_index":
+			d.BizIndex, err = s.int()
+		default:
+			err = s.unknown(key, orderKeys)
+		}
+		return err
+	})
+}
+
+func (s *scanner) transaction(d *datatype.Transaction) error {
+	return s.object(func(key []byte) (err error) {
+		var n int64
+		switch string(key) {
+		case "stock_id":
+			d.StockID, err = s.string()
+		case "action_day":
+			n, err = s.int()
+			d.ActionDay = int(n)
+		case "time":
+			n, err = s.int()
+			d.Time = int(n)
+		case "index":
+			n, err = s.int()
+			d.Index = int(n)
+		case "price":
+			d.Price, err = s.float()
+		case "volume":
+			n, err = s.int()
+			d.Volume = int(n)
+		case "turnover":
+			d.Turnover, err = s.int()
+		case "bsflag":
+			d.Bsflag, err = s.string()
+		case "order_kind":
+			d.OrderKind, err = s.string()
+		case "function_code":
+			d.FunctionCode, err = s.string()
+		case "ask_order":
+			n, err = s.int()
+			d.AskOrder = int(n)
+		case "bid_order":
+			n, err = s.int()
+			d.BidOrder = int(n)
+		case "channel":
+			n, err = s.int()
+			d.Channel = int(n)
+		case "biz_index":
+			d.BizIndex, err = s.int()
+		default:
+			err = s.unknown(key, transactionKeys)
+		}
+		return err
+	})
+}
+
+func (s *scanner) index(d *datatype.Index) error {
+	return s.object(func(key []byte) (err error) {
+		var n int64
+		switch string(key) {
+		case "stock_id":
+			d.StockID, err = s.string()
+		case "sz_code":
+			d.SZCode, err = s.string()
+		case "action_day":
+			n, err = s.int()
+			d.ActionDay = int(n)
+		case "trading_day":
+			n, err = s.int()
+			d.TradingDay = int(n)
+		case "time":
+			n, err = s.int()
+			d.Time = int(n)
+		case "prevclose":
+			d.PrevClose, err = s.float()
+		case "open":
+			d.Open, err = s.float()
+		case "high":
+			d.High, err = s.float()
+		case "low":
+			d.Low, err = s.float()
+		case "match":
+			d.Match, err = s.float()
+		case "volume":
+			d.Volume, err = s.int()
+		case "turnover":
+			d.Turnover, err = s.int()
+		default:
+			err = s.unknown(key, indexKeys)
+		}
+		return err
+	})
+}
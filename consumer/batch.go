@@ -0,0 +1,182 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// batch 是已解析, 等待投递的一批消息
+type batch struct {
+	ms    []*kafkago.Message
+	mds   []*datatype.MD
+	metas []*datatype.Meta
+}
+
+func (b *batch) len() int {
+	return len(b.ms)
+}
+
+// startBatchHandler 与 startHandler 相同, 但每个 worker 攒够 BatchSize 条或等待 BatchLinger 后调用一次 flush
+func (c *Consumer) startBatchHandler(key string, flush func(b *batch)) chan *kafkago.Message {
+	ch := make(chan *kafkago.Message, c.ChanSize)
+	startWorker := func(ch chan *kafkago.Message) {
+		c.startBatchWorker(key, ch, flush)
+	}
+	if c.Shards > 1 {
+		c.startShards(key, c.input(key, ch), startWorker)
+	} else {
+		startWorker(c.input(key, ch))
+	}
+	return ch
+}
+
+func (c *Consumer) startBatchWorker(key string, ch chan *kafkago.Message, flush func(b *batch)) {
+	c.handlers.Add(1)
+	go func() {
+		defer c.handlers.Done()
+
+		b := &batch{}
+		var linger *time.Timer
+		var lingerC <-chan time.Time
+
+		deliver := func() {
+			if linger != nil {
+				linger.Stop()
+				linger, lingerC = nil, nil
+			}
+			if b.len() == 0 {
+				return
+			}
+
+			flush(b)
+			// WithPooling 时回调拿到的元素在这里回收, 见 XXXBatchCallback
+			for i, m := range b.ms {
+				c.release(b.mds[i], b.metas[i])
+				c.ack(m)
+			}
+			b.ms, b.mds = b.ms[:0], b.mds[:0]
+			b.metas = nil // metas 切片已交给回调, 不再复用
+		}
+
+		abort := func() {
+			c.unsentMtx.Lock()
+			c.unsent[key] += b.len()
+			c.unsentMtx.Unlock()
+		}
+
+		for {
+			select {
+			case <-c.abortChan:
+				abort()
+				return
+			default:
+			}
+
+			select {
+			case m, ok := <-ch:
+				if !ok {
+					deliver()
+					return
+				}
+
+				md, meta := c.acquire(keyOf(m))
+				if _, _, err := c.parseMD(m, md, meta); err != nil {
+					c.onError(err)
+					c.release(md, meta)
+					c.ack(m)
+					continue
+				}
+				b.ms = append(b.ms, m)
+				b.mds = append(b.mds, md)
+				b.metas = append(b.metas, meta)
+
+				switch {
+				case b.len() >= c.BatchSize:
+					deliver()
+				case c.BatchLinger <= 0:
+					if len(ch) == 0 {
+						deliver()
+					}
+				case linger == nil:
+					linger = time.NewTimer(c.BatchLinger)
+					lingerC = linger.C
+				}
+			case <-lingerC:
+				linger, lingerC = nil, nil
+				deliver()
+			case <-c.abortChan:
+				abort()
+				return
+			}
+		}
+	}()
+}
+
+// flushXXXBatch 依次调用 XXXCallback(如有), 再调用一次 XXXBatchCallback, 最后更新 TiMgr
+
+func (c *Consumer) flushSnapshotBatch(b *batch) {
+	ds := make([]*datatype.Snapshot, b.len())
+	for i, md := range b.mds {
+		ds[i] = md.Data.(*datatype.Snapshot)
+		if c.SnapshotCallback != nil {
+			c.SnapshotCallback(ds[i], b.metas[i])
+		}
+	}
+	c.SnapshotBatchCallback(ds, b.metas)
+	if c.SnapshotTiMgr != nil {
+		for _, d := range ds {
+			c.SnapshotTiMgr.Update(timescale.IntTime2Time(d.Time))
+		}
+	}
+}
+
+func (c *Consumer) flushOrderBatch(b *batch) {
+	ds := make([]*datatype.Order, b.len())
+	for i, md := range b.mds {
+		ds[i] = md.Data.(*datatype.Order)
+		if c.OrderCallback != nil {
+			c.OrderCallback(ds[i], b.metas[i])
+		}
+	}
+	c.OrderBatchCallback(ds, b.metas)
+	if c.OrderTiMgr != nil {
+		for _, d := range ds {
+			c.OrderTiMgr.Update(timescale.IntTime2Time(d.Time))
+		}
+	}
+}
+
+func (c *Consumer) flushTransactionBatch(b *batch) {
+	ds := make([]*datatype.Transaction, b.len())
+	for i, md := range b.mds {
+		ds[i] = md.Data.(*datatype.Transaction)
+		if c.TransactionCallback != nil {
+			c.TransactionCallback(ds[i], b.metas[i])
+		}
+	}
+	c.TransactionBatchCallback(ds, b.metas)
+	if c.TransactionTiMgr != nil {
+		for _, d := range ds {
+			c.TransactionTiMgr.Update(timescale.IntTime2Time(d.Time))
+		}
+	}
+}
+
+func (c *Consumer) flushIndexBatch(b *batch) {
+	ds := make([]*datatype.Index, b.len())
+	for i, md := range b.mds {
+		ds[i] = md.Data.(*datatype.Index)
+		if c.IndexCallback != nil {
+			c.IndexCallback(ds[i], b.metas[i])
+		}
+	}
+	c.IndexBatchCallback(ds, b.metas)
+	if c.IndexTiMgr != nil {
+		for _, d := range ds {
+			c.IndexTiMgr.Update(timescale.IntTime2Time(d.Time))
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+func TestBatchCallback(t *testing.T) {
+	var sizes []int
+	var offsets []int64
+	c := newConsumer(nil, WithBatch(4, time.Hour), WithTransactionBatchCallback(func(ds []*datatype.Transaction, metas []*datatype.Meta) {
+		sizes = append(sizes, len(ds))
+		for i, d := range ds {
+			if d.Index != int(metas[i].Offset) {
+				t.Errorf("ds[%d].Index = %d, metas[%d].Offset = %d", i, d.Index, i, metas[i].Offset)
+			}
+			offsets = append(offsets, metas[i].Offset)
+		}
+	}))
+	c.Handle()
+
+	for i := 0; i < 10; i++ {
+		c.dispatch(context.Background(), transactionMessage(int64(i), 93000000, i, 0))
+	}
+	if err := c.drain(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两批满 4 条, 剩下 2 条在 channel 关闭时投递
+	if len(sizes) != 3 || sizes[0] != 4 || sizes[1] != 4 || sizes[2] != 2 {
+		t.Errorf("batch sizes = %v, want [4 4 2]", sizes)
+	}
+	if len(offsets) != 10 {
+		t.Errorf("delivered %d, want 10", len(offsets))
+	}
+}
+
+func TestBatchLinger(t *testing.T) {
+	batches := make(chan int, 10)
+	c := newConsumer(nil, WithBatch(100, 20*time.Millisecond), WithOrderBatchCallback(func(ds []*datatype.Order, metas []*datatype.Meta) {
+		batches <- len(ds)
+	}))
+	c.Handle()
+	defer c.drain(false)
+
+	for i := 0; i < 3; i++ {
+		c.dispatch(context.Background(), orderMessage(int64(i), 93000000, i))
+	}
+
+	select {
+	case n := <-batches:
+		if n != 3 {
+			t.Errorf("batch size = %d, want 3", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("batch not delivered after linger")
+	}
+}
@@ -0,0 +1,26 @@
+package consumer
+
+import (
+	"github.com/2997215859/gomdsdk/codec"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// codecOf 依次按消息的 codec.Header, TopicCodecs, Codec 选择消息体的编码
+func (c *Consumer) codecOf(m *kafkago.Message) (codec.Codec, error) {
+	if cd, ok, err := codec.FromHeader(m); ok {
+		return cd, err
+	}
+	if cd, ok := c.TopicCodecs[m.Topic]; ok {
+		return cd, nil
+	}
+	return c.Codec, nil
+}
+
+// peekStockID 不做完整解析, 直接从消息体中取出 stock_id
+func (c *Consumer) peekStockID(m *kafkago.Message) (string, bool) {
+	cd, err := c.codecOf(m)
+	if err != nil {
+		return "", false
+	}
+	return cd.StockID(m.Value)
+}
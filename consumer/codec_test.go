@@ -0,0 +1,44 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/codec"
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestCodec(t *testing.T) {
+	var delivered []*datatype.Order
+	c := newConsumer(nil, WithTopicCodec("order_bin", codec.Binary), WithOrderCallback(func(d *datatype.Order, meta *datatype.Meta) {
+		delivered = append(delivered, d)
+	}))
+	c.Handle()
+
+	value, err := codec.Binary.Encode(&datatype.MD{Type: datatype.TypeOrder, Data: &datatype.Order{StockID: "000001.SZ", Time: 93000000, Order: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []*kafkago.Message{
+		{Topic: "order_bin", Key: []byte(datatype.KeyOrder), Value: value},
+		{Topic: "order", Key: []byte(datatype.KeyOrder), Value: value, Headers: []kafkago.Header{{Key: codec.Header, Value: []byte("binary")}}},
+		orderMessage(2, 93000010, 2), // JSON
+	}
+	for _, m := range messages {
+		c.dispatch(context.Background(), m)
+	}
+	if err := c.drain(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delivered) != 3 {
+		t.Fatalf("delivered %d, want 3", len(delivered))
+	}
+	for _, d := range delivered {
+		if d.StockID != "000001.SZ" {
+			t.Errorf("order = %+v", d)
+		}
+	}
+}
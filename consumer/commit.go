@@ -0,0 +1,169 @@
+package consumer
+
+import (
+	"sort"
+	"sync"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type TopicPartition struct {
+	Topic     string
+	Partition int
+}
+
+type pendingOffsets struct {
+	offsets []int64       // 未提交的 offset, 递增且不重复
+	refs    map[int64]int // offset => 尚未处理完的 handler 数
+}
+
+// commitState 是一个 partition 的提交状态, 同一时刻只有一个 goroutine 在提交
+type commitState struct {
+	committing bool
+	sent       int64 // 已提交的下一条待消费 offset
+}
+
+/*
+offsetTracker 记录每条消息被几个 handler 持有, 只有当某 partition 上
+连续的一段消息全部处理完毕后才推进提交位置, 保证 at-least-once.
+rebalance 后同一 offset 可能再次被 fetch, 此时与尚未处理完的那条合并计数, 两份都处理完才越过它.
+提交在锁外进行, 某 partition 正在提交时推进的位置合并到下一次提交中
+*/
+type offsetTracker struct {
+	mtx       sync.Mutex
+	pending   map[TopicPartition]*pendingOffsets
+	acked     map[TopicPartition]int64 // 之前的消息都已处理完的位置
+	committed map[TopicPartition]int64 // commit 成功返回的位置
+	states    map[TopicPartition]*commitState
+
+	commit func(m kafkago.Message) error
+}
+
+func newOffsetTracker(commit func(m kafkago.Message) error) *offsetTracker {
+	return &offsetTracker{
+		pending:   make(map[TopicPartition]*pendingOffsets),
+		acked:     make(map[TopicPartition]int64),
+		committed: make(map[TopicPartition]int64),
+		states:    make(map[TopicPartition]*commitState),
+		commit:    commit,
+	}
+}
+
+func (t *offsetTracker) Add(m *kafkago.Message, refs int) {
+	tp := TopicPartition{Topic: m.Topic, Partition: m.Partition}
+
+	t.mtx.Lock()
+	p, ok := t.pending[tp]
+	if !ok {
+		p = &pendingOffsets{refs: make(map[int64]int)}
+		t.pending[tp] = p
+	}
+	if _, ok := p.refs[m.Offset]; ok {
+		// 重复 fetch 的 offset 不再排队, 两份的 handler 都处理完才算完成
+		p.refs[m.Offset] += refs
+	} else {
+		p.insert(m.Offset)
+		p.refs[m.Offset] = refs
+	}
+	advanced := refs == 0 && t.advance(tp, p)
+	t.mtx.Unlock()
+
+	if advanced {
+		t.flush(tp)
+	}
+}
+
+func (t *offsetTracker) Done(m *kafkago.Message) {
+	tp := TopicPartition{Topic: m.Topic, Partition: m.Partition}
+
+	t.mtx.Lock()
+	p, ok := t.pending[tp]
+	if !ok {
+		t.mtx.Unlock()
+		return
+	}
+	if _, ok := p.refs[m.Offset]; !ok {
+		t.mtx.Unlock()
+		return
+	}
+	p.refs[m.Offset]--
+	advanced := t.advance(tp, p)
+	t.mtx.Unlock()
+
+	if advanced {
+		t.flush(tp)
+	}
+}
+
+// insert 按序插入 offset, 通常是追加到末尾; rebalance 后重新 fetch 的更早的 offset 插到中间
+func (p *pendingOffsets) insert(offset int64) {
+	n := len(p.offsets)
+	if n == 0 || p.offsets[n-1] < offset {
+		p.offsets = append(p.offsets, offset)
+		return
+	}
+	i := sort.Search(n, func(i int) bool { return p.offsets[i] > offset })
+	p.offsets = append(p.offsets, 0)
+	copy(p.offsets[i+1:], p.offsets[i:])
+	p.offsets[i] = offset
+}
+
+// advance 需持有 t.mtx 调用, 返回提交位置是否前进
+func (t *offsetTracker) advance(tp TopicPartition, p *pendingOffsets) bool {
+	last := int64(-1)
+	for len(p.offsets) > 0 && p.refs[p.offsets[0]] <= 0 {
+		last = p.offsets[0]
+		delete(p.refs, last)
+		p.offsets = p.offsets[1:]
+	}
+	// 重新 fetch 的早于已完成位置的 offset 不使位置后退
+	if last < 0 || last+1 <= t.acked[tp] {
+		return false
+	}
+	t.acked[tp] = last + 1
+	return true
+}
+
+// flush 在锁外提交 tp 的最新位置; 已有 goroutine 在提交时直接返回, 由它在提交完后继续提交更新的位置.
+// 提交失败时不重试, 由下一次推进时提交更新的位置
+func (t *offsetTracker) flush(tp TopicPartition) {
+	if t.commit == nil {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	s, ok := t.states[tp]
+	if !ok {
+		s = &commitState{}
+		t.states[tp] = s
+	}
+	if s.committing {
+		return
+	}
+	s.committing = true
+	for s.sent < t.acked[tp] {
+		next := t.acked[tp]
+		t.mtx.Unlock()
+		err := t.commit(kafkago.Message{Topic: tp.Topic, Partition: tp.Partition, Offset: next - 1})
+		t.mtx.Lock()
+		s.sent = next
+		if err == nil && next > t.committed[tp] {
+			t.committed[tp] = next
+		}
+	}
+	s.committing = false
+}
+
+// Committed 返回每个 partition 已成功提交的位置(下一条待消费的 offset)
+func (t *offsetTracker) Committed() map[TopicPartition]int64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	committed := make(map[TopicPartition]int64, len(t.committed))
+	for tp, offset := range t.committed {
+		committed[tp] = offset
+	}
+	return committed
+}
@@ -0,0 +1,208 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	var commits []int64
+	tracker := newOffsetTracker(func(m kafkago.Message) error {
+		commits = append(commits, m.Offset)
+		return nil
+	})
+
+	msgs := make([]*kafkago.Message, 4)
+	for i := range msgs {
+		msgs[i] = &kafkago.Message{Topic: "md", Partition: 1, Offset: int64(10 + i)}
+	}
+
+	tracker.Add(msgs[0], 2) // 同时进入 snapshot 与 md handler
+	tracker.Add(msgs[1], 1)
+	tracker.Add(msgs[2], 0) // 没有 handler 关心的消息
+	tracker.Add(msgs[3], 1)
+
+	tracker.Done(msgs[1])
+	tracker.Done(msgs[0])
+	if len(commits) != 0 {
+		t.Fatalf("commit before all handlers of offset 10 done: %v", commits)
+	}
+
+	tracker.Done(msgs[0])
+	if len(commits) != 1 || commits[0] != 12 {
+		t.Fatalf("commits = %v, want [12]", commits)
+	}
+
+	tracker.Done(msgs[3])
+	committed := tracker.Committed()[TopicPartition{Topic: "md", Partition: 1}]
+	if committed != 14 {
+		t.Errorf("committed = %d, want 14", committed)
+	}
+}
+
+// commitSource 记录 CommitMessages 提交的 offset, block 非空时每次提交前等待它, err 非空时提交失败
+type commitSource struct {
+	mtx     sync.Mutex
+	commits []int64
+	block   chan struct{}
+	started chan struct{}
+	err     error
+}
+
+func (s *commitSource) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	<-ctx.Done()
+	return kafkago.Message{}, ctx.Err()
+}
+
+func (s *commitSource) Close() error {
+	return nil
+}
+
+func (s *commitSource) CommitMessages(ctx context.Context, msgs ...kafkago.Message) error {
+	if s.block != nil {
+		s.started <- struct{}{}
+		<-s.block
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, m := range msgs {
+		s.commits = append(s.commits, m.Offset)
+	}
+	return s.err
+}
+
+func (s *commitSource) Commits() []int64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]int64(nil), s.commits...)
+}
+
+func TestGroupCommit(t *testing.T) {
+	source := &commitSource{}
+	c := NewSourceConsumer(source)
+	c.tracker = newOffsetTracker(c.commit)
+
+	msgs := make([]*kafkago.Message, 5)
+	for i := range msgs {
+		msgs[i] = &kafkago.Message{Topic: "md", Partition: 0, Offset: int64(i)}
+		c.track(msgs[i], 1)
+	}
+
+	// 乱序处理完: 只有 offset 0 处理完后才能提交, 之后连续的一段一次提交
+	for _, i := range []int{2, 1, 4} {
+		c.ack(msgs[i])
+	}
+	if commits := source.Commits(); len(commits) != 0 {
+		t.Fatalf("commits before offset 0 done: %v", commits)
+	}
+	c.ack(msgs[0])
+	c.ack(msgs[3])
+	if commits := fmt.Sprint(source.Commits()); commits != "[2 4]" {
+		t.Errorf("commits = %s, want [2 4]", commits)
+	}
+}
+
+func TestGroupCommitCoalesce(t *testing.T) {
+	source := &commitSource{block: make(chan struct{}), started: make(chan struct{}, 1)}
+	c := NewSourceConsumer(source)
+	c.tracker = newOffsetTracker(c.commit)
+
+	msgs := make([]*kafkago.Message, 4)
+	for i := range msgs {
+		msgs[i] = &kafkago.Message{Topic: "md", Partition: 0, Offset: int64(i)}
+		c.track(msgs[i], 1)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.ack(msgs[0])
+		close(done)
+	}()
+	<-source.started
+
+	// 提交 offset 0 时其它 ack 不被阻塞, 推进的位置合并为一次提交; 提交返回前 Committed 不变
+	for _, m := range msgs[1:] {
+		c.ack(m)
+	}
+	if committed, ok := c.Committed()[TopicPartition{Topic: "md", Partition: 0}]; ok {
+		t.Errorf("committed = %d before CommitMessages returns", committed)
+	}
+
+	source.block <- struct{}{}
+	<-source.started
+	source.block <- struct{}{}
+	<-done
+	if commits := fmt.Sprint(source.Commits()); commits != "[0 3]" {
+		t.Errorf("commits = %s, want [0 3]", commits)
+	}
+	if committed := c.Committed()[TopicPartition{Topic: "md", Partition: 0}]; committed != 4 {
+		t.Errorf("committed = %d, want 4", committed)
+	}
+}
+
+func TestOffsetTrackerRefetch(t *testing.T) {
+	var commits []int64
+	tracker := newOffsetTracker(func(m kafkago.Message) error {
+		commits = append(commits, m.Offset)
+		return nil
+	})
+	msg := func(offset int64) *kafkago.Message {
+		return &kafkago.Message{Topic: "md", Partition: 0, Offset: offset}
+	}
+
+	// rebalance 后从尚未提交的 offset 10 重新 fetch, 第一份仍在处理中
+	tracker.Add(msg(10), 1)
+	tracker.Add(msg(11), 1)
+	tracker.Add(msg(10), 1)
+	tracker.Add(msg(11), 1)
+
+	tracker.Done(msg(10))
+	tracker.Done(msg(11))
+	tracker.Done(msg(11))
+	if len(commits) != 0 {
+		t.Fatalf("commit past offset 10 while one copy is still in a handler: %v", commits)
+	}
+	tracker.Done(msg(10))
+	if fmt.Sprint(commits) != "[11]" {
+		t.Fatalf("commits = %v, want [11]", commits)
+	}
+
+	// 已完成的 offset 再次 fetch 时等它处理完, 提交位置不后退
+	tracker.Add(msg(5), 1)
+	tracker.Add(msg(12), 1)
+	tracker.Done(msg(12))
+	if fmt.Sprint(commits) != "[11]" {
+		t.Fatalf("commits = %v, want [11]", commits)
+	}
+	tracker.Done(msg(5))
+	tracker.Done(msg(5)) // 多余的 ack 被忽略
+	if fmt.Sprint(commits) != "[11 12]" {
+		t.Errorf("commits = %v, want [11 12]", commits)
+	}
+	if committed := tracker.Committed()[TopicPartition{Topic: "md", Partition: 0}]; committed != 13 {
+		t.Errorf("committed = %d, want 13", committed)
+	}
+}
+
+func TestGroupCommitError(t *testing.T) {
+	source := &commitSource{err: fmt.Errorf("rebalance in progress")}
+	var errs []error
+	c := NewSourceConsumer(source, WithErrorHandler(func(err error) { errs = append(errs, err) }))
+	c.tracker = newOffsetTracker(c.commit)
+
+	m := &kafkago.Message{Topic: "md", Partition: 0, Offset: 0}
+	c.track(m, 1)
+	c.ack(m)
+
+	// 提交失败时 Committed 不前进
+	if committed, ok := c.Committed()[TopicPartition{Topic: "md", Partition: 0}]; ok {
+		t.Errorf("committed = %d after failed commit", committed)
+	}
+	if len(errs) != 1 {
+		t.Errorf("errs = %v, want one CommitError", errs)
+	}
+}
@@ -0,0 +1,44 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+func TestSnapshotConflation(t *testing.T) {
+	entered := make(chan struct{}, 1)
+	block := make(chan struct{})
+	var offsets []int64
+	c := newConsumer(nil, WithSnapshotConflation(), WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+		if meta.Offset == 0 {
+			entered <- struct{}{}
+			<-block
+		}
+		offsets = append(offsets, meta.Offset)
+	}))
+	c.Handle()
+
+	ctx := context.Background()
+	c.dispatch(ctx, symbolSnapshot(0, "000001.SZ"))
+	<-entered
+	for i, stockID := range []string{"000001.SZ", "000002.SZ", "000001.SZ", "000003.SZ", "000002.SZ", "000001.SZ"} {
+		c.dispatch(ctx, symbolSnapshot(int64(i+1), stockID))
+	}
+
+	waitDropped(t, c, datatype.KeySnapshot, 3)
+	close(block)
+	if err := c.drain(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// 回调阻塞期间排队的快照按代码合并, 代码保持第一次出现的顺序
+	if fmt.Sprint(offsets) != "[0 6 5 4]" {
+		t.Errorf("offsets = %v, want [0 6 5 4]", offsets)
+	}
+	if stats := c.QueueStats()[datatype.KeySnapshot]; stats.Dropped != 3 || stats.Len != 0 {
+		t.Errorf("stats = %+v, want 3 dropped", stats)
+	}
+}
@@ -0,0 +1,183 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// ErrorHandler 会在多个 goroutine 中被并发调用
+type ErrorHandler func(err error)
+
+// DecodeError 表示消息解析失败, Value 为原始消息体
+type DecodeError struct {
+	Key       string
+	Topic     string
+	Partition int
+	Offset    int64
+	Value     []byte
+	Err       error
+}
+
+func newDecodeError(m *kafkago.Message, err error) *DecodeError {
+	return &DecodeError{
+		Key:       string(m.Key),
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Value:     m.Value,
+		Err:       err,
+	}
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("offset(%d) decode %s error: %s", e.Offset, e.Key, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownKeyError 表示消息 key 为空或不是 datatype.KeyXXX 之一
+type UnknownKeyError struct {
+	Key       string
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+func (e *UnknownKeyError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("offset(%d) key is empty", e.Offset)
+	}
+	return fmt.Sprintf("offset(%d) unkown key(%s)", e.Offset, e.Key)
+}
+
+// FetchError 表示从 reader 拉取消息失败
+type FetchError struct {
+	Topic     string
+	Partition int
+	Err       error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("topic(%s) partition(%d) fetch error: %s", e.Topic, e.Partition, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// FileError 表示 FileSource 中的一个文件无法打开或读到中途出错(如被截断的压缩文件), 该文件的剩余部分被跳过
+type FileError struct {
+	Path string
+	Line int // 出错前已读取的行数
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// CloseError 表示关闭 reader 失败
+type CloseError struct {
+	Topic     string
+	Partition int
+	Err       error
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("topic(%s) partition(%d) failed to close reader: %s", e.Topic, e.Partition, e.Err)
+}
+
+func (e *CloseError) Unwrap() error {
+	return e.Err
+}
+
+// CommitError 表示 consumer group 模式下提交 offset 失败
+type CommitError struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Err       error
+}
+
+func (e *CommitError) Error() string {
+	return fmt.Sprintf("topic(%s) partition(%d) commit offset(%d) error: %s", e.Topic, e.Partition, e.Offset, e.Err)
+}
+
+func (e *CommitError) Unwrap() error {
+	return e.Err
+}
+
+// UndeliveredError 表示停止时仍有已读取但未交给回调的消息, Counts 的 key 为 datatype.KeyXXX
+type UndeliveredError struct {
+	Counts map[string]int
+}
+
+func (e *UndeliveredError) Error() string {
+	keys := make([]string, 0, len(e.Counts))
+	for key := range e.Counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", key, e.Counts[key]))
+	}
+	return fmt.Sprintf("undelivered messages: %s", strings.Join(parts, " "))
+}
+
+// onError 将错误交给 ErrorHandler 和 Logger; 二者都未设置时与以前一样打印到标准输出
+func (c *Consumer) onError(err error) {
+	if c.ErrorHandler != nil {
+		c.ErrorHandler(err)
+	}
+
+	if c.Logger != nil {
+		c.Logger.Error("consumer error", errorAttrs(err)...)
+		return
+	}
+
+	if c.ErrorHandler == nil {
+		fmt.Printf("%s\n", err)
+	}
+}
+
+func errorAttrs(err error) []any {
+	attrs := []any{slog.String("error", err.Error())}
+
+	var decodeErr *DecodeError
+	var keyErr *UnknownKeyError
+	var fetchErr *FetchError
+	var fileErr *FileError
+	var closeErr *CloseError
+	var commitErr *CommitError
+	switch {
+	case errors.As(err, &decodeErr):
+		attrs = append(attrs, slog.String("key", decodeErr.Key), slog.String("topic", decodeErr.Topic),
+			slog.Int("partition", decodeErr.Partition), slog.Int64("offset", decodeErr.Offset))
+	case errors.As(err, &keyErr):
+		attrs = append(attrs, slog.String("key", keyErr.Key), slog.String("topic", keyErr.Topic),
+			slog.Int("partition", keyErr.Partition), slog.Int64("offset", keyErr.Offset))
+	case errors.As(err, &fetchErr):
+		attrs = append(attrs, slog.String("topic", fetchErr.Topic), slog.Int("partition", fetchErr.Partition))
+	case errors.As(err, &fileErr):
+		attrs = append(attrs, slog.String("file", fileErr.Path), slog.Int("line", fileErr.Line))
+	case errors.As(err, &closeErr):
+		attrs = append(attrs, slog.String("topic", closeErr.Topic), slog.Int("partition", closeErr.Partition))
+	case errors.As(err, &commitErr):
+		attrs = append(attrs, slog.String("topic", commitErr.Topic), slog.Int("partition", commitErr.Partition),
+			slog.Int64("offset", commitErr.Offset))
+	}
+	return attrs
+}
@@ -0,0 +1,54 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestErrorHandler(t *testing.T) {
+	var mtx sync.Mutex
+	var errs []error
+	c := newConsumer(nil,
+		WithErrorHandler(func(err error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			errs = append(errs, err)
+		}),
+		WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {}),
+	)
+	c.Handle()
+
+	bad := []byte(`{"type":1,"data":{"stock_id":1}}`)
+	ctx := context.Background()
+	c.dispatch(ctx, &kafkago.Message{Key: []byte(datatype.KeySnapshot), Offset: 7, Value: bad})
+	if err := c.dispatch(ctx, &kafkago.Message{Key: []byte("unknown"), Offset: 8}); err != nil {
+		c.onError(err)
+	}
+	c.drain(false)
+
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v, want 2", errs)
+	}
+
+	var keyErr *UnknownKeyError
+	var decodeErr *DecodeError
+	for _, err := range errs {
+		switch {
+		case errors.As(err, &keyErr):
+			if keyErr.Offset != 8 || keyErr.Key != "unknown" {
+				t.Errorf("unexpected %+v", keyErr)
+			}
+		case errors.As(err, &decodeErr):
+			if decodeErr.Offset != 7 || string(decodeErr.Value) != string(bad) {
+				t.Errorf("unexpected %+v", decodeErr)
+			}
+		default:
+			t.Errorf("unexpected error type %T: %s", err, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package consumer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+/*
+Record 是 FileSource 中的一行, 如:
+{"topic":"snapshot","partition":0,"offset":12,"key":"snapshot","time":"2023-08-23T09:30:03.120+08:00","recv_time":"2023-08-23T09:30:03.125+08:00","value":{"type":1,"data":{...}}}
+紧凑且不含会被 encoding/json 转义的字符(<, >, &, U+2028, U+2029)的 JSON 消息体原样保存在 value 中,
+其它消息体(带空白的 JSON, codec.Binary 等)以 base64 保存在 data 中, 因此 Message 总能逐字节还原原始消息体
+*/
+type Record struct {
+	Topic     string           `json:"topic,omitempty"`
+	Partition int              `json:"partition"`
+	Offset    int64            `json:"offset"`
+	Key       string           `json:"key"`
+	Time      time.Time        `json:"time"`      // kafka 消息时间
+	RecvTime  time.Time        `json:"recv_time"` // 本地收到消息的时间
+	Value     json.RawMessage  `json:"value,omitempty"`
+	Data      []byte           `json:"data,omitempty"`
+	Headers   []kafkago.Header `json:"headers,omitempty"` // 如 codec.Header
+}
+
+func NewRecord(m *kafkago.Message) *Record {
+	record := &Record{
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       string(m.Key),
+		Time:      m.Time,
+		Headers:   m.Headers,
+	}
+	if verbatimJSON(m.Value) {
+		record.Value = m.Value
+	} else {
+		record.Data = m.Value
+	}
+	return record
+}
+
+// verbatimJSON 表示 value 作为 json.RawMessage 编码时不会被改写: 编码时会去掉空白并转义 HTML 字符
+func verbatimJSON(value []byte) bool {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil || !bytes.Equal(buf.Bytes(), value) {
+		return false
+	}
+	return !bytes.ContainsAny(value, "<>&\u2028\u2029")
+}
+
+func (r *Record) Message() kafkago.Message {
+	value := []byte(r.Value)
+	if len(r.Data) > 0 {
+		value = r.Data
+	}
+	return kafkago.Message{
+		Topic:     r.Topic,
+		Partition: r.Partition,
+		Offset:    r.Offset,
+		Key:       []byte(r.Key),
+		Value:     value,
+		Time:      r.Time,
+		Headers:   r.Headers,
+	}
+}
+
+/*
+FileSource 依次读取若干个每行一个 Record 的文件, 以 .gz/.zst 结尾的文件按 gzip/zstd 解压.
+无法解析的行使 FetchMessage 返回 *DecodeError, 再次调用时从下一行继续;
+文件无法打开或读到中途出错(如 Recorder 异常退出留下的截断文件)时返回 *FileError, 再次调用时从下一个文件继续
+*/
+type FileSource struct {
+	paths []string
+	idx   int
+	line  int
+
+	file   *os.File
+	closer io.Closer // 解压器
+	reader *bufio.Reader
+}
+
+func NewFileSource(paths ...string) (*FileSource, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("paths is empty")
+	}
+
+	source := &FileSource{paths: paths}
+	if err := source.open(); err != nil {
+		return nil, err
+	}
+	return source, nil
+}
+
+func (s *FileSource) open() error {
+	path := s.paths[s.idx]
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = file
+	var closer io.Closer
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		r, closer = gr, gr
+	case strings.HasSuffix(path, ".zst"):
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		r, closer = zr, zr.IOReadCloser()
+	}
+
+	s.file = file
+	s.closer = closer
+	s.reader = bufio.NewReaderSize(r, 1<<20)
+	s.line = 0
+	return nil
+}
+
+func (s *FileSource) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	if s.closer != nil {
+		s.closer.Close()
+	}
+	err := s.file.Close()
+	s.file, s.closer, s.reader = nil, nil, nil
+	s.line = 0
+	return err
+}
+
+// Name 返回正在读取的文件
+func (s *FileSource) Name() string {
+	if s.idx >= len(s.paths) {
+		return ""
+	}
+	return s.paths[s.idx]
+}
+
+func (s *FileSource) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return kafkago.Message{}, err
+		}
+		if s.idx >= len(s.paths) {
+			return kafkago.Message{}, io.EOF
+		}
+		if s.reader == nil {
+			if err := s.open(); err != nil {
+				return kafkago.Message{}, s.skipFile(err)
+			}
+		}
+
+		line, err := s.reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			// 当前文件读完, 切换到下一个
+			s.closeFile()
+			s.idx++
+			continue
+		}
+		if err != nil && err != io.EOF {
+			// 解压出错会一直重复, 不完整的最后一行也一并丢弃
+			return kafkago.Message{}, s.skipFile(err)
+		}
+		s.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		record := &Record{}
+		if err := json.Unmarshal(line, record); err != nil {
+			// 坏行不影响后续的行, 下次调用从下一行继续
+			return kafkago.Message{}, &DecodeError{
+				Topic:     s.Name(),
+				Partition: -1,
+				Offset:    -1,
+				Value:     append([]byte(nil), line...),
+				Err:       fmt.Errorf("%s:%d: %s", s.Name(), s.line, err),
+			}
+		}
+		return record.Message(), nil
+	}
+}
+
+// skipFile 放弃当前文件的剩余部分, 下次 FetchMessage 从下一个文件开始
+func (s *FileSource) skipFile(err error) error {
+	fileErr := &FileError{Path: s.Name(), Line: s.line, Err: err}
+	s.closeFile()
+	s.idx++
+	return fileErr
+}
+
+// Rewind 回到第一个文件的开头重新读取
+func (s *FileSource) Rewind() error {
+	s.closeFile()
+	s.idx = 0
+	return s.open()
+}
+
+func (s *FileSource) Close() error {
+	s.idx = len(s.paths)
+	return s.closeFile()
+}
@@ -0,0 +1,91 @@
+package consumer
+
+import (
+	"strings"
+	"sync/atomic"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// SymbolFilter 返回 true 的 StockID 才会被解析和投递
+type SymbolFilter func(stockID string) bool
+
+// Symbols 只保留给定的代码, 如 Symbols("000001.SZ", "600000.SH")
+func Symbols(stockIDs ...string) SymbolFilter {
+	set := make(map[string]struct{}, len(stockIDs))
+	for _, stockID := range stockIDs {
+		set[stockID] = struct{}{}
+	}
+	return func(stockID string) bool {
+		_, ok := set[stockID]
+		return ok
+	}
+}
+
+// SymbolPrefix 保留以任一前缀开头的代码, 如 SymbolPrefix("60", "00")
+func SymbolPrefix(prefixes ...string) SymbolFilter {
+	return func(stockID string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(stockID, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SymbolSuffix 保留以任一后缀结尾的代码, 如按交易所过滤 SymbolSuffix(".SZ")
+func SymbolSuffix(suffixes ...string) SymbolFilter {
+	return func(stockID string) bool {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(stockID, suffix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AnySymbol 保留满足任一 filter 的代码
+func AnySymbol(filters ...SymbolFilter) SymbolFilter {
+	return func(stockID string) bool {
+		for _, filter := range filters {
+			if filter(stockID) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterStats 是 SymbolFilter 的计数, 取不到 stock_id 的消息不做过滤, 计入 Passed
+type FilterStats struct {
+	Passed   int64
+	Filtered int64
+}
+
+type filterCounter struct {
+	passed   atomic.Int64
+	filtered atomic.Int64
+}
+
+// filtered 在解析前从消息体中取出 stock_id, 返回 true 表示消息被过滤
+func (c *Consumer) filtered(m *kafkago.Message) bool {
+	if c.SymbolFilter == nil {
+		return false
+	}
+
+	if stockID, ok := c.peekStockID(m); ok && !c.SymbolFilter(stockID) {
+		c.filterCounter.filtered.Add(1)
+		return true
+	}
+	c.filterCounter.passed.Add(1)
+	return false
+}
+
+func (c *Consumer) FilterStats() FilterStats {
+	return FilterStats{
+		Passed:   c.filterCounter.passed.Load(),
+		Filtered: c.filterCounter.filtered.Load(),
+	}
+}
@@ -0,0 +1,38 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestSymbolFilter(t *testing.T) {
+	var delivered []string
+	c := newConsumer(nil,
+		WithSymbolFilter(AnySymbol(Symbols("000001.SZ"), SymbolSuffix(".SH"))),
+		WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+			delivered = append(delivered, d.StockID)
+		}))
+	c.Handle()
+
+	for i, stockID := range []string{"000001.SZ", "000002.SZ", "600000.SH", "300750.SZ"} {
+		value := fmt.Sprintf(`{"type":1,"data":{"stock_id":"%s","time":93000000}}`, stockID)
+		m := &kafkago.Message{Key: []byte(datatype.KeySnapshot), Offset: int64(i), Value: []byte(value)}
+		if err := c.dispatch(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.drain(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(delivered) != "[000001.SZ 600000.SH]" {
+		t.Errorf("delivered = %v", delivered)
+	}
+	if stats := c.FilterStats(); stats.Passed != 2 || stats.Filtered != 2 {
+		t.Errorf("stats = %+v, want 2 passed, 2 filtered", stats)
+	}
+}
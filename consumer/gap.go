@@ -0,0 +1,190 @@
+package consumer
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+type GapKind int
+
+const (
+	GapMissing    GapKind = iota + 1 // 序号跳跃, [From, To] 尚未收到
+	GapDuplicate                     // 重复收到已处理过的序号
+	GapOutOfOrder                    // 迟到: 收到之前报告为缺失的序号
+)
+
+func (k GapKind) String() string {
+	switch k {
+	case GapMissing:
+		return "missing"
+	case GapDuplicate:
+		return "duplicate"
+	case GapOutOfOrder:
+		return "out-of-order"
+	}
+	return "unknown"
+}
+
+// GapEvent 描述一个通道上的序号异常, 重复与迟到时 From == To 为该消息的序号
+type GapEvent struct {
+	Kind     GapKind
+	Exchange string // StockID 的后缀, 如 SZ, SH
+	Channel  int
+	From     int64
+	To       int64
+	Meta     *datatype.Meta // 发现异常的消息, WithPooling 时只在回调中有效
+}
+
+// GapCallback 在 MD handler 的 goroutine 中调用
+type GapCallback func(e *GapEvent)
+
+type GapStats struct {
+	Gaps       int64 // 缺失区间数
+	Missing    int64 // 缺失且至今未收到的序号数
+	Duplicates int64
+	OutOfOrder int64
+}
+
+// MaxMissingRanges 是每个通道记录的缺失区间数上限, 超过后丢弃最早的区间, 其中的序号再到达时视为重复
+const MaxMissingRanges = 1024
+
+type gapChannel struct {
+	exchange string
+	channel  int
+}
+
+type seqRange struct {
+	from, to int64
+}
+
+type channelState struct {
+	last    int64      // 收到的最大序号
+	missing []seqRange // 按序号递增
+}
+
+/*
+GapDetector 按 (交易所, 通道) 检查逐笔委托/成交的序号(见 Sequence)是否连续:
+深交所委托与成交共用一个 ApplSeqNum 序列, 上交所用 BizIndex. 委托与成交需在同一个 goroutine 中按序检查,
+通过 WithGapDetector 使用时只检查 WithOrderedMD 投递的 MD 流, 其它回调可自行调用 Check
+*/
+type GapDetector struct {
+	Callback           GapCallback
+	SuppressDuplicates bool // Check 对重复消息返回 false, 不再投递
+
+	mtx      sync.Mutex
+	channels map[gapChannel]*channelState
+	stats    GapStats
+}
+
+func NewGapDetector(callback GapCallback, suppressDuplicates bool) *GapDetector {
+	return &GapDetector{
+		Callback:           callback,
+		SuppressDuplicates: suppressDuplicates,
+		channels:           make(map[gapChannel]*channelState),
+	}
+}
+
+func exchangeOf(stockID string) string {
+	if i := strings.LastIndexByte(stockID, '.'); i >= 0 {
+		return stockID[i+1:]
+	}
+	return ""
+}
+
+// Check 检查一条数据, 返回 false 表示该数据是重复的且应被丢弃; 非逐笔数据总是返回 true
+func (d *GapDetector) Check(md *datatype.MD, meta *datatype.Meta) bool {
+	var stockID string
+	switch data := md.Data.(type) {
+	case *datatype.Order:
+		stockID = data.StockID
+	case *datatype.Transaction:
+		stockID = data.StockID
+	default:
+		return true
+	}
+	channel, seq := Sequence(md)
+	if seq <= 0 {
+		return true
+	}
+
+	d.mtx.Lock()
+	key := gapChannel{exchange: exchangeOf(stockID), channel: channel}
+	state, ok := d.channels[key]
+	if !ok {
+		// 从通道中间开始消费, 第一条不判断缺失
+		d.channels[key] = &channelState{last: seq}
+		d.mtx.Unlock()
+		return true
+	}
+
+	var event *GapEvent
+	deliver := true
+	switch {
+	case seq == state.last+1:
+		state.last = seq
+	case seq > state.last+1:
+		r := seqRange{from: state.last + 1, to: seq - 1}
+		state.missing = append(state.missing, r)
+		if len(state.missing) > MaxMissingRanges {
+			d.stats.Missing -= state.missing[0].to - state.missing[0].from + 1
+			state.missing = state.missing[1:]
+		}
+		state.last = seq
+		d.stats.Gaps++
+		d.stats.Missing += r.to - r.from + 1
+		event = &GapEvent{Kind: GapMissing, From: r.from, To: r.to}
+	case state.fill(seq):
+		d.stats.Missing--
+		d.stats.OutOfOrder++
+		event = &GapEvent{Kind: GapOutOfOrder, From: seq, To: seq}
+	default:
+		d.stats.Duplicates++
+		event = &GapEvent{Kind: GapDuplicate, From: seq, To: seq}
+		deliver = !d.SuppressDuplicates
+	}
+	d.mtx.Unlock()
+
+	if event != nil && d.Callback != nil {
+		event.Exchange, event.Channel, event.Meta = key.exchange, key.channel, meta
+		d.Callback(event)
+	}
+	return deliver
+}
+
+// fill 在 seq 位于某个缺失区间中时将其移出并返回 true
+func (s *channelState) fill(seq int64) bool {
+	for i, r := range s.missing {
+		if seq < r.from || seq > r.to {
+			continue
+		}
+
+		var rest []seqRange
+		if r.from < seq {
+			rest = append(rest, seqRange{from: r.from, to: seq - 1})
+		}
+		if seq < r.to {
+			rest = append(rest, seqRange{from: seq + 1, to: r.to})
+		}
+		s.missing = append(s.missing[:i], append(rest, s.missing[i+1:]...)...)
+		return true
+	}
+	return false
+}
+
+func (d *GapDetector) Stats() GapStats {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	return d.stats
+}
+
+// Reset 清除所有通道的状态, 如换日时序号重新开始
+func (d *GapDetector) Reset() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	d.channels = make(map[gapChannel]*channelState)
+	d.stats = GapStats{}
+}
@@ -0,0 +1,79 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+)
+
+func TestGapDetector(t *testing.T) {
+	var events []string
+	var offsets []int64
+	detector := NewGapDetector(func(e *GapEvent) {
+		events = append(events, fmt.Sprintf("%s %s.%d [%d,%d] offset(%d)", e.Kind, e.Exchange, e.Channel, e.From, e.To, e.Meta.Offset))
+	}, true)
+	c := newConsumer(nil, WithGapDetector(detector), WithOrderedMD(time.Second), WithMDCallback(func(d *datatype.MD, meta *datatype.Meta) {
+		offsets = append(offsets, meta.Offset)
+	}))
+	c.Handle()
+
+	ctx := context.Background()
+	for _, m := range []struct {
+		offset int64
+		seq    int
+		order  bool
+	}{
+		{0, 10, true},
+		{1, 11, false},
+		{2, 15, true}, // 缺 12-14
+		{3, 13, false},
+		{4, 11, false}, // 重复
+		{5, 16, true},
+	} {
+		// 交易所时间递增, 排序后仍按到达顺序投递
+		mdTime := 93000000 + int(m.offset)*1000
+		if m.order {
+			c.dispatch(ctx, orderMessage(m.offset, mdTime, m.seq))
+		} else {
+			c.dispatch(ctx, transactionMessage(m.offset, mdTime, m.seq, 10))
+		}
+	}
+	if err := c.drain(false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"missing SZ.2011 [12,14] offset(2)",
+		"out-of-order SZ.2011 [13,13] offset(3)",
+		"duplicate SZ.2011 [11,11] offset(4)",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+	if fmt.Sprint(offsets) != "[0 1 2 3 5]" {
+		t.Errorf("delivered offsets = %v, want [0 1 2 3 5]", offsets)
+	}
+	if stats := detector.Stats(); stats.Gaps != 1 || stats.Missing != 2 || stats.Duplicates != 1 || stats.OutOfOrder != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestGapDetectorRequiresOrderedMD(t *testing.T) {
+	detector := NewGapDetector(nil, false)
+	onMD := func(d *datatype.MD, meta *datatype.Meta) {}
+	for _, opts := range [][]Option{
+		{WithGapDetector(detector), WithMDCallback(onMD)},
+		{WithGapDetector(detector), WithOrderedMD(time.Second), WithOrderCallback(func(d *datatype.Order, meta *datatype.Meta) {})},
+	} {
+		// 在读取之前返回, 不会用到 Source
+		if err := NewSourceConsumer(nil, opts...).Run(); err == nil {
+			t.Errorf("Run() = nil, want error")
+		}
+	}
+	if err := NewSourceConsumer(nil, WithGapDetector(detector), WithOrderedMD(time.Second), WithMDCallback(onMD)).validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,69 @@
+package consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+	"github.com/2997215859/gomdsdk/timgr"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const testIndex = `{"type":4,"data":{"stock_id":"000001.SH","sz_code":"000001","action_day":20230823,"trading_day":20230823,"time":93105000,"prevclose":3078.40,"open":3080.12,"high":3085.00,"low":3079.50,"match":3083.21,"volume":1234567,"turnover":987654321}}`
+
+func TestIndexCallback(t *testing.T) {
+	var mtx sync.Mutex
+	var indexes []*datatype.Index
+	var metas []*datatype.Meta
+	var mds []*datatype.MD
+
+	tis := make(chan int, 1)
+	tiMgr := timgr.NewTiMgr(timgr.WithTimescale(*timescale.DefaultTimeScale), timgr.WithTiCallback(func(ti int) {
+		tis <- ti
+	}))
+	defer tiMgr.Stop()
+
+	c := newConsumer(nil,
+		WithIndexCallback(func(d *datatype.Index, meta *datatype.Meta) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			indexes = append(indexes, d)
+			metas = append(metas, meta)
+		}),
+		WithIndexTiMgr(tiMgr),
+		WithMDCallback(func(d *datatype.MD, meta *datatype.Meta) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			mds = append(mds, d)
+		}),
+	)
+	c.Handle()
+
+	m := &kafkago.Message{Topic: "index", Partition: 2, Offset: 42, Key: []byte(datatype.KeyIndex), Value: []byte(testIndex)}
+	if err := c.dispatch(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.drain(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(indexes) != 1 {
+		t.Fatalf("index callback called %d times, want 1", len(indexes))
+	}
+	if d := indexes[0]; d.StockID != "000001.SH" || d.Match != 3083.21 || d.Time != 93105000 {
+		t.Errorf("unexpected index %+v", d)
+	}
+	if meta := metas[0]; meta.Key != datatype.KeyIndex || meta.Topic != "index" || meta.Partition != 2 || meta.Offset != 42 || meta.MDTime != 93105000 {
+		t.Errorf("unexpected meta %+v", meta)
+	}
+
+	if len(mds) != 1 || mds[0].Type != datatype.TypeIndex {
+		t.Errorf("md callback got %+v, want one index", mds)
+	}
+
+	if ti := <-tis; ti != timescale.GetTi("09:31:05") {
+		t.Errorf("ti = %d, want %d", ti, timescale.GetTi("09:31:05"))
+	}
+}
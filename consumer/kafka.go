@@ -2,19 +2,28 @@ package consumer
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/2997215859/gomdsdk/codec"
 	"github.com/2997215859/gomdsdk/datatype"
 	"github.com/2997215859/gomdsdk/timescale"
 	"github.com/2997215859/gomdsdk/timgr"
-	"github.com/segmentio/kafka-go"
 	kafkago "github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/sasl/scram"
 )
 
-const DefaultChanSize = 10000000
+const DefaultChanSize = 100000
+
+const DefaultCommitInterval = time.Second
+
+const DefaultDrainTimeout = 10 * time.Second
+
+const DefaultBatchSize = 1000
 
 type SnapshotCallback func(d *datatype.Snapshot, meta *datatype.Meta)
 type OrderCallback func(d *datatype.Order, meta *datatype.Meta)
@@ -22,6 +31,16 @@ type TransactionCallback func(d *datatype.Transaction, meta *datatype.Meta)
 type IndexCallback func(d *datatype.Index, meta *datatype.Meta)
 type MDCallback func(d *datatype.MD, meta *datatype.Meta)
 
+// XXXBatchCallback 一次收到至多 BatchSize 条数据, ds[i] 对应 metas[i];
+// 两个切片归回调所有, WithPooling 时其中的元素与单条回调一样只在回调中有效, 回调返回后仍要使用须先 Clone
+type SnapshotBatchCallback func(ds []*datatype.Snapshot, metas []*datatype.Meta)
+type OrderBatchCallback func(ds []*datatype.Order, metas []*datatype.Meta)
+type TransactionBatchCallback func(ds []*datatype.Transaction, metas []*datatype.Meta)
+type IndexBatchCallback func(ds []*datatype.Index, metas []*datatype.Meta)
+
+// RawCallback 在 reader 的 goroutine 中收到消息后立即调用, 早于解析与分发, 多个 partition 会并发调用
+type RawCallback func(m *kafkago.Message, recvTime time.Time)
+
 type Consumer struct {
 	Brokers   []string
 	Topic     string
@@ -29,13 +48,34 @@ type Consumer struct {
 	Partition int
 	MaxBytes  int
 
-	reader *kafkago.Reader
+	GroupID        string        // 非空时由 consumer group 分配 partition 并提交 offset
+	CommitInterval time.Duration // consumer group 模式下 offset 的提交间隔, 0 为同步提交
+
+	Partitions []int // MultiConsumer 订阅的 partition, 为空表示全部
+
+	StartTime time.Time // 非零时按 kafka 消息时间定位起始 offset, 覆盖 Offset
+	EndTime   time.Time // 非零时读到晚于该时间的消息即停止, 不能与 GroupID 同时使用
+
+	EndOffset          int64 // 非负时读到该 offset(不含)即停止
+	UntilHighWaterMark bool  // 只读到启动时各 partition 的 high-water mark
+
+	dialer  *kafkago.Dialer
+	sources []Source // 每个 partition 一个 reader, consumer group 模式下只有一个
+	tracker *offsetTracker
 
 	SnapshotCallback    SnapshotCallback
 	OrderCallback       OrderCallback
 	TransactionCallback TransactionCallback
 	IndexCallback       IndexCallback
 	MDCallback          MDCallback
+	RawCallback         RawCallback
+
+	SnapshotBatchCallback    SnapshotBatchCallback
+	OrderBatchCallback       OrderBatchCallback
+	TransactionBatchCallback TransactionBatchCallback
+	IndexBatchCallback       IndexBatchCallback
+	BatchSize                int           // 每批最多的条数
+	BatchLinger              time.Duration // 一批中第一条数据最多等待的时间, 0 表示 channel 中暂无数据时即投递
 
 	mdChannel       chan *kafkago.Message
 	snapshotChan    chan *kafkago.Message
@@ -44,25 +84,73 @@ type Consumer struct {
 	indexChan       chan *kafkago.Message
 
 	ChanSize int64
-	stopChan chan struct{}
+	Overflow map[string]OverflowPolicy // 以 datatype.KeyXXX 为 key, 默认 OverflowBlock
+
+	overflow *overflow
+
+	Codec       codec.Codec            // 默认的消息体编码, 默认为 codec.JSON
+	TopicCodecs map[string]codec.Codec // 按 topic 指定编码, 消息的 codec.Header 优先
+
+	SymbolFilter  SymbolFilter
+	filterCounter filterCounter
+
+	Pooled bool // 复用解码对象, 回调返回后对象即被回收, 见 WithPooling
+
+	Shards         int // >1 时每种数据按 StockID 分片到多个 worker 并行处理, 同一 StockID 保持顺序
+	ShardQueueSize int // 每个分片 worker 的队列长度
+
+	GapDetector *GapDetector // 检查 WithOrderedMD 投递的 MD 流中逐笔数据的通道序号, 不检查按类型的回调, 见 WithGapDetector
+
+	OrderedWindow time.Duration // >0 时 MDCallback 按交易所时间与通道序号排序投递, 见 startOrderedHandler
+
+	DrainTimeout  time.Duration // 停止后等待 handler 处理完已排队消息的最长时间, 0 表示一直等待
+	DiscardOnStop bool          // 停止后直接丢弃已排队的消息
+
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+	abortChan chan struct{} // 关闭后 handler 不再处理剩余消息
+	handlers  sync.WaitGroup
+	unsentMtx sync.Mutex
+	unsent    map[string]int // 停止时阻塞在 channel 上未能投递的消息数
+
+	shardChans map[string][]chan *kafkago.Message
 
 	SnapshotTiMgr    *timgr.TiMgr
 	OrderTiMgr       *timgr.TiMgr
 	TransactionTiMgr *timgr.TiMgr
+	IndexTiMgr       *timgr.TiMgr
 	MDTiMgr          *timgr.TiMgr
 
 	Username string
 	Password string
+
+	RetryPolicy       RetryPolicy
+	ConnStateCallback ConnStateCallback
+
+	ErrorHandler ErrorHandler
+	Logger       *slog.Logger // 非空时错误通过 Logger 输出, 否则在未设置 ErrorHandler 时打印到标准输出
 }
 
-func NewConsumer(topic string, brokers []string, opts ...Option) *Consumer {
+func newConsumer(brokers []string, opts ...Option) *Consumer {
 	consumer := &Consumer{
-		Brokers:  brokers,
-		Topic:    topic,
-		Offset:   kafkago.LastOffset,
-		MaxBytes: 10e6, // 10MB
-		ChanSize: DefaultChanSize,
-		stopChan: make(chan struct{}),
+		Brokers:        brokers,
+		Offset:         kafkago.LastOffset,
+		EndOffset:      -1,
+		MaxBytes:       10e6, // 10MB
+		ChanSize:       DefaultChanSize,
+		CommitInterval: DefaultCommitInterval,
+		DrainTimeout:   DefaultDrainTimeout,
+		BatchSize:      DefaultBatchSize,
+		Overflow:       make(map[string]OverflowPolicy),
+		overflow:       newOverflow(),
+		RetryPolicy:    DefaultRetryPolicy,
+		Codec:          codec.JSON,
+		TopicCodecs:    make(map[string]codec.Codec),
+		stopChan:       make(chan struct{}),
+		abortChan:      make(chan struct{}),
+		unsent:         make(map[string]int),
+		ShardQueueSize: DefaultShardQueueSize,
+		shardChans:     make(map[string][]chan *kafkago.Message),
 	}
 
 	for _, o := range opts {
@@ -74,133 +162,240 @@ func NewConsumer(topic string, brokers []string, opts ...Option) *Consumer {
 		panic(err)
 	}
 
-	dialer := &kafka.Dialer{
+	consumer.dialer = &kafkago.Dialer{
 		Timeout:       10 * time.Second,
 		DualStack:     true,
 		SASLMechanism: mechanism,
 	}
+	return consumer
+}
 
-	consumer.reader = kafkago.NewReader(kafkago.ReaderConfig{
-		Brokers:   consumer.Brokers,
-		Topic:     consumer.Topic,
-		Partition: consumer.Partition,
-		MaxBytes:  consumer.MaxBytes,
-		Dialer:    dialer,
-	})
-	consumer.reader.SetOffset(consumer.Offset)
+func NewConsumer(topic string, brokers []string, opts ...Option) *Consumer {
+	consumer := newConsumer(brokers, opts...)
+	consumer.Topic = topic
+
+	if consumer.GroupID != "" {
+		consumer.addGroupReader([]string{topic})
+		return consumer
+	}
+
+	consumer.addPartitionReader(topic, consumer.Partition)
 	return consumer
 }
 
+func (c *Consumer) addPartitionReader(topic string, partition int) {
+	reader := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:   c.Brokers,
+		Topic:     topic,
+		Partition: partition,
+		MaxBytes:  c.MaxBytes,
+		Dialer:    c.dialer,
+	})
+	reader.SetOffset(c.Offset)
+	c.sources = append(c.sources, reader)
+}
+
+// addGroupReader 创建一个 consumer group reader, partition 由 group 分配
+func (c *Consumer) addGroupReader(topics []string) {
+	// consumer group 只认 FirstOffset/LastOffset, 且只在没有已提交 offset 时生效
+	startOffset := kafkago.LastOffset
+	if c.Offset == kafkago.FirstOffset || c.Offset == 0 {
+		startOffset = kafkago.FirstOffset
+	}
+
+	config := kafkago.ReaderConfig{
+		Brokers:        c.Brokers,
+		GroupID:        c.GroupID,
+		MaxBytes:       c.MaxBytes,
+		Dialer:         c.dialer,
+		StartOffset:    startOffset,
+		CommitInterval: c.CommitInterval,
+	}
+	if len(topics) == 1 {
+		config.Topic = topics[0]
+	} else {
+		config.GroupTopics = topics
+	}
+
+	c.sources = append(c.sources, kafkago.NewReader(config))
+	c.tracker = newOffsetTracker(c.commit)
+}
+
+// commit 只在 consumer group 模式下调用, 此时只有一个 reader
+func (c *Consumer) commit(m kafkago.Message) error {
+	committer, ok := c.sources[0].(Committer)
+	if !ok {
+		return nil
+	}
+	err := committer.CommitMessages(context.Background(), m)
+	if err != nil {
+		c.onError(&CommitError{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset, Err: err})
+	}
+	return err
+}
+
+// ack 在 handler 处理完一条消息后调用, consumer group 模式下据此推进提交位置
+func (c *Consumer) ack(m *kafkago.Message) {
+	if c.tracker != nil {
+		c.tracker.Done(m)
+	}
+}
+
+// Committed 返回 consumer group 模式下各 partition 已提交的位置(下一条待消费的 offset):
+// CommitMessages 成功返回后才更新. CommitInterval > 0 时 kafka-go 异步提交, 此时是已交给 reader 的位置,
+// broker 上的位置最多落后 CommitInterval; WithCommitInterval(0) 时同步提交, 即 broker 已确认的位置
+func (c *Consumer) Committed() map[TopicPartition]int64 {
+	if c.tracker == nil {
+		return nil
+	}
+	return c.tracker.Committed()
+}
+
 func (c *Consumer) ParseSnapshot(m *kafkago.Message) (*datatype.MD, *datatype.Snapshot, *datatype.Meta, error) {
-	meta := &datatype.Meta{
-		Key:    string(m.Key),
-		Offset: m.Offset,
+	return c.parseSnapshot(m, &datatype.MD{Data: &datatype.Snapshot{}}, &datatype.Meta{})
+}
+
+// parseSnapshot 解码到给定的 md 与 meta 中, md.Data 须为 *datatype.Snapshot
+func (c *Consumer) parseSnapshot(m *kafkago.Message, md *datatype.MD, meta *datatype.Meta) (*datatype.MD, *datatype.Snapshot, *datatype.Meta, error) {
+	*meta = datatype.Meta{
+		Key:       keyOf(m),
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
 	}
 
-	snapshot := &datatype.Snapshot{}
-	md := &datatype.MD{
-		Type: datatype.TypeUnknown,
-		Data: snapshot,
+	snapshot := md.Data.(*datatype.Snapshot)
+	md.Type = datatype.TypeUnknown
+	cd, err := c.codecOf(m)
+	if err != nil {
+		return md, nil, meta, newDecodeError(m, err)
 	}
-	if err := json.Unmarshal(m.Value, &md); err != nil {
-		return md, nil, meta, fmt.Errorf("snapshot json.Unmarshal(%+v) error: %s", snapshot, err)
+	if err := cd.Decode(m.Value, md); err != nil {
+		return md, nil, meta, newDecodeError(m, fmt.Errorf("snapshot %s decode(%+v) error: %s", cd.Name(), snapshot, err))
 	}
 	meta.MDTime = snapshot.Time
 
 	if md.Type != datatype.TypeSnapshot {
-		return md, nil, meta, fmt.Errorf("data.type != datatype.TypeSnapshot")
+		return md, nil, meta, newDecodeError(m, fmt.Errorf("data.type != datatype.TypeSnapshot"))
 	}
 
 	return md, snapshot, meta, nil
 }
 
 func (c *Consumer) ParseOrder(m *kafkago.Message) (*datatype.MD, *datatype.Order, *datatype.Meta, error) {
-	meta := &datatype.Meta{
-		Key:    string(m.Key),
-		Offset: m.Offset,
+	return c.parseOrder(m, &datatype.MD{Data: &datatype.Order{}}, &datatype.Meta{})
+}
+
+// parseOrder 解码到给定的 md 与 meta 中, md.Data 须为 *datatype.Order
+func (c *Consumer) parseOrder(m *kafkago.Message, md *datatype.MD, meta *datatype.Meta) (*datatype.MD, *datatype.Order, *datatype.Meta, error) {
+	*meta = datatype.Meta{
+		Key:       keyOf(m),
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
 	}
 
-	order := &datatype.Order{}
-	md := &datatype.MD{
-		Type: datatype.TypeUnknown,
-		Data: order,
+	order := md.Data.(*datatype.Order)
+	md.Type = datatype.TypeUnknown
+	cd, err := c.codecOf(m)
+	if err != nil {
+		return md, nil, meta, newDecodeError(m, err)
 	}
-	if err := json.Unmarshal(m.Value, &md); err != nil {
-		return md, nil, meta, fmt.Errorf("order json.Unmarshal(%+v) error: %s", order, err)
+	if err := cd.Decode(m.Value, md); err != nil {
+		return md, nil, meta, newDecodeError(m, fmt.Errorf("order %s decode(%+v) error: %s", cd.Name(), order, err))
 	}
 	meta.MDTime = order.Time
 
 	if md.Type != datatype.TypeOrder {
-		return md, nil, meta, fmt.Errorf("data.type != datatype.TypeOrder")
+		return md, nil, meta, newDecodeError(m, fmt.Errorf("data.type != datatype.TypeOrder"))
 	}
 
 	return md, order, meta, nil
 }
 
 func (c *Consumer) ParseTransaction(m *kafkago.Message) (*datatype.MD, *datatype.Transaction, *datatype.Meta, error) {
-	meta := &datatype.Meta{
-		Key:    string(m.Key),
-		Offset: m.Offset,
-	}
+	return c.parseTransaction(m, &datatype.MD{Data: &datatype.Transaction{}}, &datatype.Meta{})
+}
 
-	transaction := &datatype.Transaction{}
-	md := &datatype.MD{
-		Type: datatype.TypeUnknown,
-		Data: transaction,
+// parseTransaction 解码到给定的 md 与 meta 中, md.Data 须为 *datatype.Transaction
+func (c *Consumer) parseTransaction(m *kafkago.Message, md *datatype.MD, meta *datatype.Meta) (*datatype.MD, *datatype.Transaction, *datatype.Meta, error) {
+	*meta = datatype.Meta{
+		Key:       keyOf(m),
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
 	}
 
-	if err := json.Unmarshal(m.Value, &md); err != nil {
-		return md, nil, meta, fmt.Errorf("transaction json.Unmarshal(%+v) error: %s", transaction, err)
+	transaction := md.Data.(*datatype.Transaction)
+	md.Type = datatype.TypeUnknown
+
+	cd, err := c.codecOf(m)
+	if err != nil {
+		return md, nil, meta, newDecodeError(m, err)
+	}
+	if err := cd.Decode(m.Value, md); err != nil {
+		return md, nil, meta, newDecodeError(m, fmt.Errorf("transaction %s decode(%+v) error: %s", cd.Name(), transaction, err))
 	}
 	meta.MDTime = transaction.Time
 
 	if md.Type != datatype.TypeTransaction {
-		return md, nil, meta, fmt.Errorf("data.type != datatype.TypeTransaction")
+		return md, nil, meta, newDecodeError(m, fmt.Errorf("data.type != datatype.TypeTransaction"))
 	}
 
 	return md, transaction, meta, nil
 }
 
 func (c *Consumer) ParseIndex(m *kafkago.Message) (*datatype.MD, *datatype.Index, *datatype.Meta, error) {
-	meta := &datatype.Meta{
-		Key:    string(m.Key),
-		Offset: m.Offset,
+	return c.parseIndex(m, &datatype.MD{Data: &datatype.Index{}}, &datatype.Meta{})
+}
+
+// parseIndex 解码到给定的 md 与 meta 中, md.Data 须为 *datatype.Index
+func (c *Consumer) parseIndex(m *kafkago.Message, md *datatype.MD, meta *datatype.Meta) (*datatype.MD, *datatype.Index, *datatype.Meta, error) {
+	*meta = datatype.Meta{
+		Key:       keyOf(m),
+		Topic:     m.Topic,
+		Partition: m.Partition,
+		Offset:    m.Offset,
 	}
 
-	index := &datatype.Index{}
-	md := &datatype.MD{
-		Type: datatype.TypeUnknown,
-		Data: index,
+	index := md.Data.(*datatype.Index)
+	md.Type = datatype.TypeUnknown
+	cd, err := c.codecOf(m)
+	if err != nil {
+		return md, nil, meta, newDecodeError(m, err)
 	}
-	if err := json.Unmarshal(m.Value, &md); err != nil {
-		return md, nil, meta, fmt.Errorf("snapshot json.Unmarshal(%+v) error: %s", index, err)
+	if err := cd.Decode(m.Value, md); err != nil {
+		return md, nil, meta, newDecodeError(m, fmt.Errorf("index %s decode(%+v) error: %s", cd.Name(), index, err))
 	}
 	meta.MDTime = index.Time
 
 	if md.Type != datatype.TypeIndex {
-		return md, nil, meta, fmt.Errorf("data.type != datatype.TypeIndex")
+		return md, nil, meta, newDecodeError(m, fmt.Errorf("data.type != datatype.TypeIndex"))
 	}
 
 	return md, index, meta, nil
 }
 
 func (c *Consumer) ParseMD(m *kafkago.Message) (*datatype.MD, *datatype.Meta, error) {
-	key := string(m.Key)
-	var md *datatype.MD
-	var meta *datatype.Meta
+	return c.parseMD(m, &datatype.MD{Data: newData(keyOf(m))}, &datatype.Meta{})
+}
+
+// parseMD 解码到给定的 md 与 meta 中, md.Data 须为消息 key 对应的类型
+func (c *Consumer) parseMD(m *kafkago.Message, md *datatype.MD, meta *datatype.Meta) (*datatype.MD, *datatype.Meta, error) {
+	key := keyOf(m)
 	var err error
 
 	switch key {
 	case datatype.KeySnapshot:
-		md, _, meta, err = c.ParseSnapshot(m)
+		md, _, meta, err = c.parseSnapshot(m, md, meta)
 	case datatype.KeyOrder:
-		md, _, meta, err = c.ParseOrder(m)
+		md, _, meta, err = c.parseOrder(m, md, meta)
 	case datatype.KeyTransaction:
-		md, _, meta, err = c.ParseTransaction(m)
+		md, _, meta, err = c.parseTransaction(m, md, meta)
 	case datatype.KeyIndex:
-		md, _, meta, err = c.ParseIndex(m)
+		md, _, meta, err = c.parseIndex(m, md, meta)
 	default:
-		return nil, nil, fmt.Errorf("offset(%d) message.Key is unknown", m.Offset)
+		return nil, nil, &UnknownKeyError{Key: key, Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
 	}
 
 	if err != nil {
@@ -208,181 +403,497 @@ func (c *Consumer) ParseMD(m *kafkago.Message) (*datatype.MD, *datatype.Meta, er
 	}
 
 	if md == nil {
-		return nil, nil, fmt.Errorf("offset(%d) md is nil", m.Offset)
+		return nil, nil, newDecodeError(m, fmt.Errorf("md is nil"))
 	}
 
 	if md.Type == datatype.TypeUnknown {
-		return md, meta, fmt.Errorf("offset(%d) md.Type is datatype.TypeUnknown", m.Offset)
+		return md, meta, newDecodeError(m, fmt.Errorf("md.Type is datatype.TypeUnknown"))
 	}
 
 	return md, meta, nil
 }
 
+func (c *Consumer) handleSnapshot(m *kafkago.Message) {
+	defer c.ack(m)
+
+	md, meta := c.acquire(datatype.KeySnapshot)
+	defer c.release(md, meta)
+
+	_, snapshot, meta, err := c.parseSnapshot(m, md, meta)
+	if err != nil {
+		c.onError(err)
+		return
+	}
+
+	if c.SnapshotCallback != nil {
+		c.SnapshotCallback(snapshot, meta)
+	}
+
+	if c.SnapshotTiMgr != nil {
+		c.SnapshotTiMgr.Update(timescale.IntTime2Time(snapshot.Time))
+	}
+}
+
+func (c *Consumer) handleOrder(m *kafkago.Message) {
+	defer c.ack(m)
+
+	md, meta := c.acquire(datatype.KeyOrder)
+	defer c.release(md, meta)
+
+	_, order, meta, err := c.parseOrder(m, md, meta)
+	if err != nil {
+		c.onError(err)
+		return
+	}
+	if c.OrderCallback != nil {
+		c.OrderCallback(order, meta)
+	}
+	if c.OrderTiMgr != nil {
+		c.OrderTiMgr.Update(timescale.IntTime2Time(order.Time))
+	}
+}
+
+func (c *Consumer) handleTransaction(m *kafkago.Message) {
+	defer c.ack(m)
+
+	md, meta := c.acquire(datatype.KeyTransaction)
+	defer c.release(md, meta)
+
+	_, transaction, meta, err := c.parseTransaction(m, md, meta)
+	if err != nil {
+		c.onError(err)
+		return
+	}
+	if c.TransactionCallback != nil {
+		c.TransactionCallback(transaction, meta)
+	}
+	if c.TransactionTiMgr != nil {
+		c.TransactionTiMgr.Update(timescale.IntTime2Time(transaction.Time))
+	}
+}
+
+func (c *Consumer) handleIndex(m *kafkago.Message) {
+	defer c.ack(m)
+
+	md, meta := c.acquire(datatype.KeyIndex)
+	defer c.release(md, meta)
+
+	_, index, meta, err := c.parseIndex(m, md, meta)
+	if err != nil {
+		c.onError(err)
+		return
+	}
+	if c.IndexCallback != nil {
+		c.IndexCallback(index, meta)
+	}
+	if c.IndexTiMgr != nil {
+		c.IndexTiMgr.Update(timescale.IntTime2Time(index.Time))
+	}
+}
+
+func (c *Consumer) handleMD(m *kafkago.Message) {
+	defer c.ack(m)
+
+	md, meta := c.acquire(keyOf(m))
+	defer c.release(md, meta)
+
+	md, meta, err := c.parseMD(m, md, meta)
+	if err != nil {
+		c.onError(err)
+		return
+	}
+	c.deliverMD(md, meta)
+}
+
 func (c *Consumer) Handle() {
-	if c.SnapshotCallback != nil || c.SnapshotTiMgr != nil {
-		c.snapshotChan = make(chan *kafkago.Message, c.ChanSize)
-
-		go func() {
-			for {
-				select {
-				case m := <-c.snapshotChan:
-					_, snapshot, meta, err := c.ParseSnapshot(m)
-					if err != nil {
-						fmt.Printf("c.ParseSnapshot error: %s\n", err)
-						break
-					}
-
-					if c.SnapshotCallback != nil {
-						c.SnapshotCallback(snapshot, meta)
-					}
-
-					if c.SnapshotTiMgr != nil {
-						c.SnapshotTiMgr.Update(timescale.IntTime2Time(snapshot.Time))
-					}
-				case <-c.stopChan:
-					return
-				}
-			}
-		}()
-	}
-	if c.OrderCallback != nil || c.OrderTiMgr != nil {
-		c.orderChan = make(chan *kafkago.Message, c.ChanSize)
-		go func() {
-			for {
-				select {
-				case m := <-c.orderChan:
-					_, order, meta, err := c.ParseOrder(m)
-					if err != nil {
-						fmt.Printf("c.ParseOrder error: %s\n", err)
-						break
-					}
-					if c.OrderCallback != nil {
-						c.OrderCallback(order, meta)
-					}
-					if c.OrderTiMgr != nil {
-						c.OrderTiMgr.Update(timescale.IntTime2Time(order.Time))
-					}
-				case <-c.stopChan:
-					return
-				}
-			}
-		}()
-	}
-	if c.TransactionCallback != nil || c.TransactionTiMgr != nil {
-		c.transactionChan = make(chan *kafkago.Message, c.ChanSize)
-		go func() {
-			for {
-				select {
-				case m := <-c.transactionChan:
-					_, transaction, meta, err := c.ParseTransaction(m)
-					if err != nil {
-						fmt.Printf("c.ParseTransaction error: %s\n", err)
-						break
-					}
-					if c.TransactionCallback != nil {
-						c.TransactionCallback(transaction, meta)
-					}
-					if c.TransactionTiMgr != nil {
-						c.TransactionTiMgr.Update(timescale.IntTime2Time(transaction.Time))
-					}
-				case <-c.stopChan:
-					return
-				}
-			}
-		}()
+	if c.SnapshotBatchCallback != nil {
+		c.snapshotChan = c.startBatchHandler(datatype.KeySnapshot, c.flushSnapshotBatch)
+	} else if c.SnapshotCallback != nil || c.SnapshotTiMgr != nil {
+		c.snapshotChan = c.startHandler(datatype.KeySnapshot, c.handleSnapshot)
+	}
+	if c.OrderBatchCallback != nil {
+		c.orderChan = c.startBatchHandler(datatype.KeyOrder, c.flushOrderBatch)
+	} else if c.OrderCallback != nil || c.OrderTiMgr != nil {
+		c.orderChan = c.startHandler(datatype.KeyOrder, c.handleOrder)
+	}
+	if c.TransactionBatchCallback != nil {
+		c.transactionChan = c.startBatchHandler(datatype.KeyTransaction, c.flushTransactionBatch)
+	} else if c.TransactionCallback != nil || c.TransactionTiMgr != nil {
+		c.transactionChan = c.startHandler(datatype.KeyTransaction, c.handleTransaction)
+	}
+	if c.IndexBatchCallback != nil {
+		c.indexChan = c.startBatchHandler(datatype.KeyIndex, c.flushIndexBatch)
+	} else if c.IndexCallback != nil || c.IndexTiMgr != nil {
+		c.indexChan = c.startHandler(datatype.KeyIndex, c.handleIndex)
 	}
 	if c.MDCallback != nil || c.MDTiMgr != nil {
-		c.mdChannel = make(chan *kafkago.Message, c.ChanSize)
-		go func() {
-			for {
-				select {
-				case m := <-c.mdChannel:
-					md, meta, err := c.ParseMD(m)
-					if err != nil {
-						fmt.Printf("c.ParseMD error: %s\n", err)
-						break
-					}
-					if c.MDCallback != nil {
-						c.MDCallback(md, meta)
-					}
-					if c.MDTiMgr != nil {
-						c.MDTiMgr.Update(timescale.IntTime2Time(meta.MDTime))
-					}
-
-				case <-c.stopChan:
+		if c.OrderedWindow > 0 {
+			c.mdChannel = c.startOrderedHandler()
+		} else {
+			c.mdChannel = c.startHandler(datatype.KeyMD, c.handleMD)
+		}
+	}
+}
+
+// startHandler 创建 key 对应的 channel 并启动 handler, Shards > 1 时按 StockID 分片到多个 worker
+func (c *Consumer) startHandler(key string, handle func(m *kafkago.Message)) chan *kafkago.Message {
+	ch := make(chan *kafkago.Message, c.ChanSize)
+	startWorker := func(ch chan *kafkago.Message) {
+		c.startWorker(ch, handle)
+	}
+	if c.Shards > 1 {
+		c.startShards(key, c.input(key, ch), startWorker)
+	} else {
+		startWorker(c.input(key, ch))
+	}
+	return ch
+}
+
+// startWorker 启动一个 goroutine 处理 ch, 直到 ch 被关闭且取空, 或 abortChan 被关闭
+func (c *Consumer) startWorker(ch chan *kafkago.Message, handle func(m *kafkago.Message)) {
+	c.handlers.Add(1)
+	go func() {
+		defer c.handlers.Done()
+		for {
+			// 优先响应 abort, 避免 select 随机选中 ch 多处理消息
+			select {
+			case <-c.abortChan:
+				return
+			default:
+			}
+
+			select {
+			case m, ok := <-ch:
+				if !ok {
 					return
 				}
+				handle(m)
+			case <-c.abortChan:
+				return
 			}
-		}()
+		}
+	}()
+}
+
+// chans 返回已创建的 channel, key 为 datatype.KeyXXX
+func (c *Consumer) chans() map[string]chan *kafkago.Message {
+	chans := make(map[string]chan *kafkago.Message)
+	for key, ch := range map[string]chan *kafkago.Message{
+		datatype.KeySnapshot:    c.snapshotChan,
+		datatype.KeyOrder:       c.orderChan,
+		datatype.KeyTransaction: c.transactionChan,
+		datatype.KeyIndex:       c.indexChan,
+		datatype.KeyMD:          c.mdChannel,
+	} {
+		if ch != nil {
+			chans[key] = ch
+		}
 	}
+	return chans
 }
 
 func (c *Consumer) ReadMessage(ctx context.Context) error {
-	r := c.reader
-	m, err := r.ReadMessage(ctx)
+	return c.readMessage(ctx, c.sources[0])
+}
+
+func (c *Consumer) readMessage(ctx context.Context, r Source) error {
+	// 使用 FetchMessage, consumer group 模式下由 handler 处理完后再提交
+	m, err := r.FetchMessage(ctx)
 	if err != nil {
 		return err
 	}
 
+	return c.dispatch(ctx, &m)
+}
+
+func (c *Consumer) dispatch(ctx context.Context, m *kafkago.Message) error {
 	key := string(m.Key)
 	if key == "" {
-		return fmt.Errorf("offset(%d) key is empty", m.Offset)
+		c.track(m, 0)
+		return &UnknownKeyError{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
 	}
 
+	var ch chan *kafkago.Message
 	switch key {
 	case datatype.KeySnapshot:
-		if c.SnapshotCallback != nil || c.snapshotChan != nil {
-			c.snapshotChan <- &m
-		}
+		ch = c.snapshotChan
 	case datatype.KeyOrder:
-		if c.OrderCallback != nil || c.orderChan != nil {
-			c.orderChan <- &m
-		}
+		ch = c.orderChan
 	case datatype.KeyTransaction:
-		if c.TransactionCallback != nil || c.transactionChan != nil {
-			c.transactionChan <- &m
-		}
+		ch = c.transactionChan
 	case datatype.KeyIndex:
-		if c.IndexCallback != nil || c.indexChan != nil {
-			c.indexChan <- &m
-		}
+		ch = c.indexChan
 	default:
-		return fmt.Errorf("offset(%d) unkown key(%s)", m.Offset, key)
+		c.track(m, 0)
+		return &UnknownKeyError{Key: key, Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
 	}
 
-	if c.MDCallback != nil && c.mdChannel != nil {
-		c.mdChannel <- &m
+	// 被过滤的消息不再解析, 但仍需记录以便提交 offset
+	if c.filtered(m) {
+		c.track(m, 0)
+		return nil
+	}
+
+	refs := 0
+	if ch != nil {
+		refs++
+	}
+	if c.mdChannel != nil {
+		refs++
+	}
+	c.track(m, refs)
+
+	if ch != nil {
+		c.send(ctx, key, ch, m)
+	}
+	if c.mdChannel != nil {
+		c.send(ctx, datatype.KeyMD, c.mdChannel, m)
 	}
 	return nil
 }
 
+// send 在 channel 已满时按 Overflow 处理, 默认阻塞直到 ctx 被取消, 此时消息记为未投递
+func (c *Consumer) send(ctx context.Context, key string, ch chan *kafkago.Message, m *kafkago.Message) {
+	if c.sendOverflow(ctx, key, ch, m) {
+		return
+	}
+	c.sendBlock(ctx, key, ch, m)
+}
+
+func (c *Consumer) sendBlock(ctx context.Context, key string, ch chan *kafkago.Message, m *kafkago.Message) {
+	select {
+	case ch <- m:
+	case <-ctx.Done():
+		c.unsentMtx.Lock()
+		c.unsent[key]++
+		c.unsentMtx.Unlock()
+	}
+}
+
+// track 在消息进入 channel 前登记持有它的 handler 数
+func (c *Consumer) track(m *kafkago.Message, refs int) {
+	if c.tracker != nil {
+		c.tracker.Add(m, refs)
+	}
+}
+
+// Read 直到 Stop 被调用, 或所有 reader 都读完指定区间(EndOffset/UntilHighWaterMark/EndTime)才返回
 func (c *Consumer) Read() error {
-	ctx := context.Background()
-	r := c.reader
+	ctx, cancel := c.stopContext(context.Background())
+	defer cancel()
 
-	defer func() error {
+	return c.read(ctx)
+}
+
+func (c *Consumer) read(ctx context.Context) error {
+	seeked, err := c.seekStartTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	ends := make([]int64, len(c.sources))
+	for i, r := range c.sources {
+		end, empty, err := c.endOffset(ctx, r)
+		if err != nil {
+			return err
+		}
+		if empty {
+			end = 0
+		}
+		ends[i] = end
+	}
+
+	// 任一 reader 重试次数耗尽时停止所有 reader
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var errOnce sync.Once
+	var readErr error
+
+	var wg sync.WaitGroup
+	for i, r := range c.sources {
+		wg.Add(1)
+		go func(r Source, end int64) {
+			defer wg.Done()
+			if err := c.readLoop(ctx, r, end, !seeked); err != nil {
+				errOnce.Do(func() {
+					readErr = err
+					cancel()
+				})
+			}
+		}(r, ends[i])
+	}
+	wg.Wait()
+	return readErr
+}
+
+// readLoop 读取 r 直到 ctx 被取消, r 读完或读到 end(不含, -1 表示不设上限);
+// 连续拉取失败达到 RetryPolicy.MaxAttempts 次时返回 *FetchError. filterStart 为 false 时 r 已按 StartTime 定位, 不再按消息时间过滤
+func (c *Consumer) readLoop(ctx context.Context, r Source, end int64, filterStart bool) error {
+	topic, partition := sourceName(r)
+	conn := c.newConnTracker(topic, partition)
+
+	defer func() {
 		if err := r.Close(); err != nil {
-			fmt.Printf("failed to close reader: %s\n", err)
-			return fmt.Errorf("failed to close reader: %s", err)
+			c.onError(&CloseError{Topic: topic, Partition: partition, Err: err})
 		}
-		return nil
 	}()
 
+	if end == 0 {
+		return nil
+	}
+
 	for {
+		m, err := r.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		var decodeErr *DecodeError
+		var fileErr *FileError
+		if errors.As(err, &decodeErr) || errors.As(err, &fileErr) {
+			c.onError(err)
+			continue
+		}
+		if err != nil {
+			fetchErr := &FetchError{Topic: topic, Partition: partition, Err: err}
+			c.onError(fetchErr)
+			if !conn.failed(ctx, err) {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fetchErr
+			}
+			continue
+		}
+		conn.received(m.Partition, m.Offset)
+		recvTime := time.Now()
+
+		if c.pastEnd(&m) || (end >= 0 && m.Offset >= end) {
+			return nil
+		}
+		if filterStart && c.beforeStart(&m) {
+			continue
+		}
+
+		if c.RawCallback != nil {
+			c.RawCallback(&m, recvTime)
+		}
+
+		if err := c.dispatch(ctx, &m); err != nil {
+			c.onError(err)
+		}
+
+		if end >= 0 && m.Offset+1 >= end {
+			return nil
+		}
+	}
+}
+
+// stopContext 返回一个在 parent 取消或 Stop 被调用时取消的 ctx
+func (c *Consumer) stopContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
 		select {
 		case <-c.stopChan:
-			return nil
-		default:
-			if err := c.ReadMessage(ctx); err != nil {
-				fmt.Printf("c.ReadMessage: %s\n", err)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// drain 在所有 reader 退出后关闭各 channel, 等待 handler 处理完剩余消息;
+// stopped 时最多等待 DrainTimeout, DiscardOnStop 时直接丢弃剩余消息
+func (c *Consumer) drain(stopped bool) error {
+	chans := c.chans()
+	for _, ch := range chans {
+		close(ch)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.handlers.Wait()
+		close(done)
+	}()
+
+	if stopped && c.DiscardOnStop {
+		close(c.abortChan)
+		<-done
+	} else if stopped && c.DrainTimeout > 0 {
+		timer := time.NewTimer(c.DrainTimeout)
+		select {
+		case <-done:
+			timer.Stop()
+		case <-timer.C:
+			close(c.abortChan)
+			<-done
+		}
+	} else {
+		<-done
+	}
+
+	c.unsentMtx.Lock()
+	defer c.unsentMtx.Unlock()
+
+	undelivered := &UndeliveredError{Counts: make(map[string]int)}
+	for key, n := range c.unsent {
+		undelivered.Counts[key] += n
+	}
+	for key, ch := range chans {
+		if n := len(ch); n > 0 {
+			undelivered.Counts[key] += n
+		}
+	}
+	for key, shards := range c.shardChans {
+		for _, ch := range shards {
+			if n := len(ch); n > 0 {
+				undelivered.Counts[key] += n
 			}
 		}
 	}
+	if len(undelivered.Counts) == 0 {
+		return nil
+	}
+	return undelivered
+}
+
+// RunContext 在 ctx 取消或 Stop 后停止拉取消息, 投递(或按 DiscardOnStop 丢弃)已排队的消息,
+// 关闭 reader 后返回; 有未投递的消息时返回 *UndeliveredError.
+// 读完指定区间(见 Read)时等待所有已读消息处理完毕后返回
+func (c *Consumer) RunContext(ctx context.Context) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+
+	ctx, cancel := c.stopContext(ctx)
+	defer cancel()
+
+	c.Handle()
+	err := c.read(ctx)
+	if drainErr := c.drain(ctx.Err() != nil); err == nil {
+		err = drainErr
+	}
+	return err
+}
+
+// validate 检查 Option 的组合
+func (c *Consumer) validate() error {
+	// group reader 读取所有分配到的 partition, 一个 partition 越过 EndTime 就会停止其它 partition
+	if !c.EndTime.IsZero() && c.GroupID != "" {
+		return fmt.Errorf("end time is not available with group id(%s)", c.GroupID)
+	}
+	// 深交所委托与成交共用一个序号, 只有 WithOrderedMD 在一个 goroutine 中按序投递二者
+	if c.GapDetector != nil && (c.OrderedWindow <= 0 || (c.MDCallback == nil && c.MDTiMgr == nil)) {
+		return fmt.Errorf("gap detector requires WithOrderedMD and WithMDCallback")
+	}
+	return nil
 }
 
 func (c *Consumer) Run() error {
-	go c.Handle()
-	return c.Read()
+	return c.RunContext(context.Background())
 }
 
 func (c *Consumer) Start() {
@@ -390,5 +901,7 @@ func (c *Consumer) Start() {
 }
 
 func (c *Consumer) Stop() {
-	close(c.stopChan)
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+	})
 }
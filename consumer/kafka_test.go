@@ -1,11 +1,21 @@
 package consumer
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+	"github.com/2997215859/gomdsdk/timgr"
+	kafkago "github.com/segmentio/kafka-go"
 )
 
 var snapshotCnt = 0
@@ -65,18 +75,25 @@ func TransactionCB(d *datatype.Transaction, meta *datatype.Meta) {
 	}
 }
 
+// TestKafka 需要可用的 kafka, 通过环境变量 GOMDSDK_KAFKA_BROKERS(逗号分隔),
+// GOMDSDK_KAFKA_USERNAME, GOMDSDK_KAFKA_PASSWORD 指定, 未设置时跳过
 func TestKafka(t *testing.T) {
+	brokers := os.Getenv("GOMDSDK_KAFKA_BROKERS")
+	if brokers == "" {
+		t.Skip("GOMDSDK_KAFKA_BROKERS is not set")
+	}
+
 	// var Timescale *timescale.TimeScale = timescale.NewTimeScale("09:30:00", "15:01:00", 60)
 	// tiMgr := timgr.NewTiMgr(timgr.WithTiSeqCallback(TiCallback), timgr.WithTimescale(*Timescale))
 
 	consumer := NewConsumer(
 		"transaction",
-		[]string{"192.168.1.14:19092"},
+		strings.Split(brokers, ","),
 		WithOffset(0),
 		// WithMDCallback(Callback),
 		// WithSnapshotTiMgr(tiMgr),
 		WithTransactionCallback(TransactionCB),
-		WithAuth("md_consumer", "md_c_TT4sHThu"),
+		WithAuth(os.Getenv("GOMDSDK_KAFKA_USERNAME"), os.Getenv("GOMDSDK_KAFKA_PASSWORD")),
 	)
 
 	if err := consumer.Run(); err != nil {
@@ -84,3 +101,230 @@ func TestKafka(t *testing.T) {
 		return
 	}
 }
+
+func writeRecords(t *testing.T, path string, messages []kafkago.Message) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := gzip.NewWriter(f)
+	defer w.Close()
+
+	enc := json.NewEncoder(w)
+	for i := range messages {
+		if err := enc.Encode(NewRecord(&messages[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	messages := []kafkago.Message{
+		{Topic: "md", Offset: 0, Key: []byte(datatype.KeySnapshot), Value: []byte(testSnapshot)},
+		{Topic: "md", Offset: 1, Key: []byte(datatype.KeyOrder), Value: []byte(`{"type":2,"data":{"stock_id":"001324.SZ","action_day":20230823,"time":93048490,"order":243233,"price":33.3,"volume":200.0,"order_kind":"2","function_code":"B","channel":2013}}`)},
+		{Topic: "md", Offset: 2, Key: []byte(datatype.KeyTransaction), Value: []byte(`{"type":3,"data":{"stock_id":"001324.SZ","action_day":20230823,"time":93101000,"index":243234,"price":33.3,"volume":100,"function_code":"0","ask_order":243200,"bid_order":243233,"channel":2013}}`)},
+		{Topic: "md", Offset: 3, Key: []byte(datatype.KeyIndex), Value: []byte(testIndex)},
+	}
+	path := filepath.Join(t.TempDir(), "md.jsonl.gz")
+	writeRecords(t, path, messages)
+
+	source, err := NewFileSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mtx sync.Mutex
+	var offsets []int64
+	var transaction *datatype.Transaction
+	tis := make(chan int, 1)
+	tiMgr := timgr.NewTiMgr(timgr.WithTiCallback(func(ti int) { tis <- ti }))
+	defer tiMgr.Stop()
+
+	consumer := NewSourceConsumer(source,
+		WithMDCallback(func(d *datatype.MD, meta *datatype.Meta) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			offsets = append(offsets, meta.Offset)
+		}),
+		WithTransactionCallback(func(d *datatype.Transaction, meta *datatype.Meta) {
+			transaction = d
+		}),
+		WithSnapshotTiMgr(tiMgr),
+	)
+
+	// Source 读完后 Run 返回
+	if err := consumer.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(offsets) != len(messages) {
+		t.Errorf("md callback got offsets %v, want %d messages", offsets, len(messages))
+	}
+	if transaction == nil || transaction.BidOrder != 243233 || transaction.Volume != 100 {
+		t.Errorf("unexpected transaction %+v", transaction)
+	}
+	if ti := <-tis; ti != timescale.GetTi("09:30:00") {
+		t.Errorf("ti = %d, want %d", ti, timescale.GetTi("09:30:00"))
+	}
+}
+
+func TestFileSourceMalformed(t *testing.T) {
+	var lines []string
+	for i := int64(0); i < 3; i++ {
+		b, _ := json.Marshal(NewRecord(&kafkago.Message{Topic: "md", Offset: i, Key: []byte(datatype.KeySnapshot), Value: []byte(testSnapshot)}))
+		lines = append(lines, string(b))
+	}
+	// 第 2 行被截断
+	lines[1] = lines[1][:len(lines[1])/2]
+	path := filepath.Join(t.TempDir(), "md.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := NewFileSource(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mtx sync.Mutex
+	var offsets []int64
+	var errs []error
+	var states []ConnState
+	consumer := NewSourceConsumer(source,
+		WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			offsets = append(offsets, meta.Offset)
+		}),
+		WithErrorHandler(func(err error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			errs = append(errs, err)
+		}),
+		WithConnStateCallback(func(e ConnEvent) {
+			states = append(states, e.State)
+		}),
+	)
+
+	// 坏行报告后跳过, 不按拉取失败重试
+	if err := consumer.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(offsets) != "[0 2]" {
+		t.Errorf("offsets = %v, want [0 2]", offsets)
+	}
+	var decodeErr *DecodeError
+	if len(errs) != 1 || !errors.As(errs[0], &decodeErr) || decodeErr.Topic != path {
+		t.Errorf("errs = %v, want one DecodeError", errs)
+	}
+	if fmt.Sprint(states) != "[connected]" {
+		t.Errorf("states = %v, want [connected]", states)
+	}
+}
+
+func TestFileSourceBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	records := func(name string, offsets ...int64) string {
+		var messages []kafkago.Message
+		for _, offset := range offsets {
+			messages = append(messages, kafkago.Message{Topic: "md", Offset: offset, Key: []byte(datatype.KeySnapshot), Value: []byte(testSnapshot)})
+		}
+		path := filepath.Join(dir, name)
+		writeRecords(t, path, messages)
+		return path
+	}
+	a := records("a.jsonl.gz", 0, 1)
+	// Recorder 异常退出留下的截断文件
+	b := records("b.jsonl.gz", 10, 11, 12)
+	data, err := os.ReadFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.jsonl.gz")
+	c := records("c.jsonl.gz", 20, 21)
+
+	source, err := NewFileSource(a, b, missing, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mtx sync.Mutex
+	var offsets []int64
+	var errs []string
+	consumer := NewSourceConsumer(source,
+		WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			offsets = append(offsets, meta.Offset)
+		}),
+		WithErrorHandler(func(err error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			var fileErr *FileError
+			if errors.As(err, &fileErr) {
+				errs = append(errs, filepath.Base(fileErr.Path))
+			} else {
+				errs = append(errs, err.Error())
+			}
+		}),
+	)
+
+	// 坏文件报告后跳过, 不按拉取失败重试, 也不提前结束
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.Run()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		consumer.Stop()
+		<-done
+		t.Fatal("Run did not return")
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if fmt.Sprint(errs) != "[b.jsonl.gz missing.jsonl.gz]" {
+		t.Errorf("errs = %v", errs)
+	}
+	var good []int64
+	for _, offset := range offsets {
+		if offset < 10 || offset >= 20 {
+			good = append(good, offset)
+		}
+	}
+	if fmt.Sprint(good) != "[0 1 20 21]" {
+		t.Errorf("offsets = %v, want 0 1 20 21 and a prefix of b", offsets)
+	}
+}
+
+func TestRecordVerbatim(t *testing.T) {
+	for _, value := range []string{
+		testSnapshot,
+		`{"type":1, "data":{"stock_id":"000001.SZ"}}`, // 空白
+		`{"type":1,"data":{"stock_id":"<A&B>"}}`,      // 会被转义的字符
+		"\x00\x01binary",
+		"",
+	} {
+		b, err := json.Marshal(NewRecord(&kafkago.Message{Key: []byte(datatype.KeySnapshot), Value: []byte(value)}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := &Record{}
+		if err := json.Unmarshal(b, record); err != nil {
+			t.Fatal(err)
+		}
+		if got := record.Message().Value; string(got) != value {
+			t.Errorf("value = %q, want %q", got, value)
+		}
+	}
+	if record := NewRecord(&kafkago.Message{Value: []byte(testSnapshot)}); len(record.Value) == 0 {
+		t.Errorf("compact JSON should be kept in value")
+	}
+}
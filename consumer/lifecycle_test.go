@@ -0,0 +1,70 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const testSnapshot = `{"type":1,"data":{"stock_id":"000001.SZ","trading_day":20230823,"time":93000000,"match":11.37}}`
+
+func snapshotMessage(offset int64) *kafkago.Message {
+	return &kafkago.Message{Key: []byte(datatype.KeySnapshot), Offset: offset, Value: []byte(testSnapshot)}
+}
+
+func TestDrainDeliversQueued(t *testing.T) {
+	delivered := 0
+	c := newConsumer(nil, WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+		time.Sleep(time.Millisecond)
+		delivered++
+	}))
+	c.Handle()
+
+	for i := 0; i < 10; i++ {
+		if err := c.dispatch(context.Background(), snapshotMessage(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.drain(true); err != nil {
+		t.Fatalf("drain error: %s", err)
+	}
+	if delivered != 10 {
+		t.Errorf("delivered = %d, want 10", delivered)
+	}
+}
+
+func TestDrainDiscard(t *testing.T) {
+	entered := make(chan struct{}, 5)
+	block := make(chan struct{})
+	c := newConsumer(nil, WithDiscardOnStop(), WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+		entered <- struct{}{}
+		<-block
+	}))
+	c.Handle()
+
+	for i := 0; i < 5; i++ {
+		c.dispatch(context.Background(), snapshotMessage(int64(i)))
+	}
+
+	// 第一条消息被 handler 取走阻塞在回调中, drain 开始丢弃后才解除阻塞
+	<-entered
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(block)
+	}()
+
+	err := c.drain(true)
+	var undelivered *UndeliveredError
+	if !errors.As(err, &undelivered) {
+		t.Fatalf("drain error = %v, want *UndeliveredError", err)
+	}
+	if n := undelivered.Counts[datatype.KeySnapshot]; n != 4 {
+		t.Errorf("undelivered snapshot = %d, want 4", n)
+	}
+	t.Logf("%s", err)
+}
@@ -0,0 +1,88 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// MultiConsumer 同时订阅多个 topic, 每个 partition 一个 reader,
+// 所有消息汇入同一组 channel, 回调与 Consumer 完全一致, 来源见 Meta.Topic/Meta.Partition
+type MultiConsumer struct {
+	*Consumer
+
+	Topics []string
+}
+
+func NewMultiConsumer(topics []string, brokers []string, opts ...Option) (*MultiConsumer, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("topics is empty")
+	}
+
+	consumer := &MultiConsumer{
+		Consumer: newConsumer(brokers, opts...),
+		Topics:   topics,
+	}
+
+	if consumer.GroupID != "" {
+		consumer.addGroupReader(topics)
+		return consumer, nil
+	}
+
+	partitions, err := consumer.lookupPartitions(topics)
+	if err != nil {
+		return nil, err
+	}
+	if err := consumer.addReaders(partitions); err != nil {
+		return nil, err
+	}
+	return consumer, nil
+}
+
+// addReaders 为 partitions 中 ID 在 Partitions 里(为空时为全部)的每个 partition 创建一个 reader
+func (c *MultiConsumer) addReaders(partitions []kafkago.Partition) error {
+	wanted := make(map[int]bool, len(c.Partitions))
+	for _, p := range c.Partitions {
+		wanted[p] = true
+	}
+
+	for _, p := range partitions {
+		if len(wanted) > 0 && !wanted[p.ID] {
+			continue
+		}
+		c.addPartitionReader(p.Topic, p.ID)
+	}
+
+	if len(c.sources) == 0 {
+		return fmt.Errorf("no partition of topics(%v) matches partitions(%v)", c.Topics, c.Partitions)
+	}
+	return nil
+}
+
+func (c *Consumer) lookupPartitions(topics []string) ([]kafkago.Partition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.dialer.Timeout)
+	defer cancel()
+
+	if len(c.Brokers) == 0 {
+		return nil, fmt.Errorf("brokers is empty")
+	}
+
+	var err error
+	for _, broker := range c.Brokers {
+		var conn *kafkago.Conn
+		if conn, err = c.dialer.DialContext(ctx, "tcp", broker); err != nil {
+			continue
+		}
+
+		var partitions []kafkago.Partition
+		conn.SetDeadline(time.Now().Add(c.dialer.Timeout))
+		partitions, err = conn.ReadPartitions(topics...)
+		conn.Close()
+		if err == nil {
+			return partitions, nil
+		}
+	}
+	return nil, fmt.Errorf("read partitions of topics(%v) error: %s", topics, err)
+}
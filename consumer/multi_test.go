@@ -0,0 +1,105 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// sliceSource 依次返回 messages, 之后返回 io.EOF
+type sliceSource struct {
+	messages []kafkago.Message
+}
+
+func (s *sliceSource) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	if len(s.messages) == 0 {
+		return kafkago.Message{}, io.EOF
+	}
+	m := s.messages[0]
+	s.messages = s.messages[1:]
+	return m, nil
+}
+
+func (s *sliceSource) Close() error {
+	return nil
+}
+
+func TestMultiConsumerPartitions(t *testing.T) {
+	partitions := []kafkago.Partition{
+		{Topic: "snapshot", ID: 0},
+		{Topic: "snapshot", ID: 1},
+		{Topic: "order", ID: 0},
+		{Topic: "order", ID: 1},
+		{Topic: "order", ID: 2},
+	}
+
+	for _, tt := range []struct {
+		wanted []int
+		want   string
+	}{
+		{nil, "[snapshot/0 snapshot/1 order/0 order/1 order/2]"},
+		{[]int{1, 2}, "[snapshot/1 order/1 order/2]"},
+		{[]int{3}, ""},
+	} {
+		c := &MultiConsumer{Consumer: newConsumer([]string{"localhost:9092"}, WithPartitions(tt.wanted...)), Topics: []string{"snapshot", "order"}}
+		err := c.addReaders(partitions)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("partitions %v: no error", tt.wanted)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 每个 partition 一个 reader
+		var got []string
+		for _, r := range c.sources {
+			topic, partition := sourceName(r)
+			got = append(got, fmt.Sprintf("%s/%d", topic, partition))
+			r.Close()
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("partitions %v: readers = %v, want %s", tt.wanted, got, tt.want)
+		}
+	}
+}
+
+func TestMultiConsumerMeta(t *testing.T) {
+	var mtx sync.Mutex
+	var got []string
+	c := &MultiConsumer{
+		Consumer: newConsumer(nil, WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			got = append(got, fmt.Sprintf("%s/%d@%d", meta.Topic, meta.Partition, meta.Offset))
+		})),
+		Topics: []string{"snapshot-sz", "snapshot-sh"},
+	}
+	for _, tp := range []TopicPartition{{Topic: "snapshot-sz", Partition: 0}, {Topic: "snapshot-sz", Partition: 1}, {Topic: "snapshot-sh", Partition: 0}} {
+		source := &sliceSource{}
+		for offset := int64(0); offset < 2; offset++ {
+			source.messages = append(source.messages, kafkago.Message{
+				Topic: tp.Topic, Partition: tp.Partition, Offset: offset, Key: []byte(datatype.KeySnapshot), Value: []byte(testSnapshot),
+			})
+		}
+		c.sources = append(c.sources, source)
+	}
+
+	// 各 reader 的消息汇入同一个回调, Meta 标明来源
+	if err := c.Run(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := "[snapshot-sh/0@0 snapshot-sh/0@1 snapshot-sz/0@0 snapshot-sz/0@1 snapshot-sz/1@0 snapshot-sz/1@1]"
+	if fmt.Sprint(got) != want {
+		t.Errorf("metas = %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// withLeader 依次尝试各 broker, 连接 topic/partition 的 leader 后执行 do
+func (c *Consumer) withLeader(ctx context.Context, topic string, partition int, do func(conn *kafkago.Conn) error) error {
+	if len(c.Brokers) == 0 {
+		return fmt.Errorf("brokers is empty")
+	}
+
+	var err error
+	for _, broker := range c.Brokers {
+		var conn *kafkago.Conn
+		if conn, err = c.dialer.DialLeader(ctx, "tcp", broker, topic, partition); err != nil {
+			continue
+		}
+
+		conn.SetDeadline(time.Now().Add(c.dialer.Timeout))
+		err = do(conn)
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("topic(%s) partition(%d) error: %s", topic, partition, err)
+}
+
+// OffsetsAt 通过 kafka 的 offset-for-time 查询每个 partition 上第一条时间不早于 t 的消息,
+// 没有这样的消息时返回 kafkago.LastOffset
+func (c *Consumer) OffsetsAt(ctx context.Context, t time.Time) (map[TopicPartition]int64, error) {
+	offsets := make(map[TopicPartition]int64, len(c.sources))
+	for _, source := range c.sources {
+		r, ok := source.(*kafkago.Reader)
+		if !ok {
+			return nil, fmt.Errorf("offset lookup is only available for kafka reader")
+		}
+
+		config := r.Config()
+		if config.GroupID != "" {
+			return nil, fmt.Errorf("offset lookup is not available with group id(%s)", config.GroupID)
+		}
+
+		var offset int64
+		err := c.withLeader(ctx, config.Topic, config.Partition, func(conn *kafkago.Conn) (err error) {
+			offset, err = conn.ReadOffset(t)
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read offset at %s error: %s", t, err)
+		}
+		if offset < 0 {
+			offset = kafkago.LastOffset
+		}
+		offsets[TopicPartition{Topic: config.Topic, Partition: config.Partition}] = offset
+	}
+	return offsets, nil
+}
+
+// seekStartTime 将各 kafka reader 定位到 StartTime 对应的 offset, 返回是否已定位;
+// 未定位时(有非 kafka 的 Source)由 beforeStart 过滤
+func (c *Consumer) seekStartTime(ctx context.Context) (bool, error) {
+	if c.StartTime.IsZero() {
+		return false, nil
+	}
+	for _, source := range c.sources {
+		if _, ok := source.(*kafkago.Reader); !ok {
+			return false, nil
+		}
+	}
+
+	offsets, err := c.OffsetsAt(ctx, c.StartTime)
+	if err != nil {
+		return false, err
+	}
+
+	for _, source := range c.sources {
+		r := source.(*kafkago.Reader)
+		config := r.Config()
+		if err := r.SetOffset(offsets[TopicPartition{Topic: config.Topic, Partition: config.Partition}]); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// bounded 表示 Read 在读完指定区间后会自行返回
+func (c *Consumer) bounded() bool {
+	return c.EndOffset >= 0 || c.UntilHighWaterMark
+}
+
+// endOffset 返回 source 的结束位置(不含), -1 表示不设上限;
+// 第二个返回值表示区间在开始前就已经为空. 非 kafka 的 Source 读完即结束, 只受 EndOffset 限制
+func (c *Consumer) endOffset(ctx context.Context, source Source) (int64, bool, error) {
+	if !c.bounded() {
+		return -1, false, nil
+	}
+
+	r, ok := source.(*kafkago.Reader)
+	if !ok {
+		return c.EndOffset, c.EndOffset == 0, nil
+	}
+
+	config := r.Config()
+	if config.GroupID != "" {
+		return 0, false, fmt.Errorf("bounded read is not available with group id(%s)", config.GroupID)
+	}
+
+	var first, last int64
+	err := c.withLeader(ctx, config.Topic, config.Partition, func(conn *kafkago.Conn) (err error) {
+		first, last, err = conn.ReadOffsets()
+		return err
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("read offsets error: %s", err)
+	}
+
+	end := c.EndOffset
+	if c.UntilHighWaterMark && (end < 0 || last < end) {
+		end = last
+	}
+
+	start := r.Offset()
+	switch start {
+	case kafkago.FirstOffset:
+		start = first
+	case kafkago.LastOffset:
+		start = last
+	}
+	return end, start >= end, nil
+}
+
+// beforeStart 只用于没有按 StartTime 定位的 Source: kafka 的消息时间不单调, 定位后稍早于 StartTime 的消息不应丢弃
+func (c *Consumer) beforeStart(m *kafkago.Message) bool {
+	return !c.StartTime.IsZero() && m.Time.Before(c.StartTime)
+}
+
+func (c *Consumer) pastEnd(m *kafkago.Message) bool {
+	return !c.EndTime.IsZero() && m.Time.After(c.EndTime)
+}
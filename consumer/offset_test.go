@@ -0,0 +1,119 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// streamSource 像 kafka 一样没有结尾: 返回 n 条消息后阻塞到 ctx 取消, fetched 为已返回的消息数
+type streamSource struct {
+	n       int
+	fetched int
+}
+
+func (s *streamSource) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	if s.fetched >= s.n {
+		<-ctx.Done()
+		return kafkago.Message{}, ctx.Err()
+	}
+	offset := int64(s.fetched)
+	s.fetched++
+	return kafkago.Message{
+		Topic:  "snapshot",
+		Offset: offset,
+		Time:   timescale.TradingTime(20230823, 93000000).Add(time.Duration(offset) * time.Second),
+		Key:    []byte(datatype.KeySnapshot),
+		Value:  []byte(testSnapshot),
+	}, nil
+}
+
+func (s *streamSource) Close() error {
+	return nil
+}
+
+func TestBoundedRead(t *testing.T) {
+	for _, tt := range []struct {
+		opt     Option
+		fetched int
+		want    string
+	}{
+		// 读到 EndOffset(不含)的前一条即返回, 不再拉取
+		{WithEndOffset(5), 5, "[0 1 2 3 4]"},
+		{WithEndOffset(0), 0, "[]"},
+		// EndTime 只能在拉到更晚的消息后才知道已读完
+		{WithEndTime(timescale.TradingTime(20230823, 93002000)), 4, "[0 1 2]"},
+	} {
+		source := &streamSource{n: 10}
+		var mtx sync.Mutex
+		offsets := []int64{}
+		c := NewSourceConsumer(source, WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			offsets = append(offsets, meta.Offset)
+		}), tt.opt)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- c.Run()
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			c.Stop()
+			<-done
+			t.Fatalf("Run did not return at the bound, offsets = %v", offsets)
+		}
+
+		if source.fetched != tt.fetched {
+			t.Errorf("fetched %d messages, want %d", source.fetched, tt.fetched)
+		}
+		if fmt.Sprint(offsets) != tt.want {
+			t.Errorf("offsets = %v, want %s", offsets, tt.want)
+		}
+	}
+}
+
+func TestEndTimeWithGroup(t *testing.T) {
+	c := NewSourceConsumer(nil, WithGroupID("md"), WithEndTime(timescale.TradingTime(20230823, 150000000)))
+	if err := c.Run(); err == nil {
+		t.Errorf("Run() = nil, want error")
+	}
+}
+
+func TestStartTimeFilter(t *testing.T) {
+	start := timescale.TradingTime(20230823, 93002000)
+	for _, tt := range []struct {
+		filterStart bool
+		want        string
+	}{
+		// 没有按 StartTime 定位的 Source 按消息时间过滤
+		{true, "[2 3]"},
+		// 已定位的 kafka reader 不再过滤, 消息时间不单调
+		{false, "[0 1 2 3]"},
+	} {
+		var offsets []int64
+		c := NewSourceConsumer(nil, WithStartTime(start), WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+			offsets = append(offsets, meta.Offset)
+		}))
+		c.Handle()
+		if err := c.readLoop(context.Background(), &streamSource{n: 4}, 4, tt.filterStart); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.drain(false); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(offsets) != tt.want {
+			t.Errorf("filterStart %v: offsets = %v, want %s", tt.filterStart, offsets, tt.want)
+		}
+	}
+}
@@ -1,6 +1,14 @@
 package consumer
 
-import "github.com/2997215859/gomdsdk/timgr"
+import (
+	"log/slog"
+	"time"
+
+	"github.com/2997215859/gomdsdk/codec"
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+	"github.com/2997215859/gomdsdk/timgr"
+)
 
 type Option func(consumer *Consumer)
 
@@ -39,18 +47,51 @@ func WithTransactionCallback(cb TransactionCallback) Option {
 	}
 }
 
+func WithIndexCallback(cb IndexCallback) Option {
+	return func(consumer *Consumer) {
+		consumer.IndexCallback = cb
+	}
+}
+
+func WithRawCallback(cb RawCallback) Option {
+	return func(consumer *Consumer) {
+		consumer.RawCallback = cb
+	}
+}
+
+// WithOrderedMD 将所有类型(及所有 topic/partition)的数据按交易所时间与通道序号合并后
+// 依次交给 MDCallback, window 为等待乱序数据的时间窗口
+func WithOrderedMD(window time.Duration) Option {
+	return func(consumer *Consumer) {
+		consumer.OrderedWindow = window
+	}
+}
+
 func WithChanSize(chanSize int64) Option {
 	return func(consumer *Consumer) {
 		consumer.ChanSize = chanSize
 	}
 }
 
+// WithOverflowPolicy 设置 key(datatype.KeyXXX) 对应的 channel 已满时的处理方式
+func WithOverflowPolicy(key string, policy OverflowPolicy) Option {
+	return func(consumer *Consumer) {
+		consumer.Overflow[key] = policy
+	}
+}
+
 func WithSnapshotTiMgr(tiMgr *timgr.TiMgr) Option {
 	return func(consumer *Consumer) {
 		consumer.SnapshotTiMgr = tiMgr
 	}
 }
 
+func WithIndexTiMgr(tiMgr *timgr.TiMgr) Option {
+	return func(consumer *Consumer) {
+		consumer.IndexTiMgr = tiMgr
+	}
+}
+
 func WithMDTiMgr(tiMgr *timgr.TiMgr) Option {
 	return func(consumer *Consumer) {
 		consumer.MDTiMgr = tiMgr
@@ -63,3 +104,175 @@ func WithAuth(username, password string) Option {
 		consumer.Password = password
 	}
 }
+
+func WithGroupID(groupID string) Option {
+	return func(consumer *Consumer) {
+		consumer.GroupID = groupID
+	}
+}
+
+func WithCommitInterval(interval time.Duration) Option {
+	return func(consumer *Consumer) {
+		consumer.CommitInterval = interval
+	}
+}
+
+func WithPartitions(partitions ...int) Option {
+	return func(consumer *Consumer) {
+		consumer.Partitions = partitions
+	}
+}
+
+func WithStartTime(t time.Time) Option {
+	return func(consumer *Consumer) {
+		consumer.StartTime = t
+	}
+}
+
+// WithStartTradingDay 从交易日 tradingDay(YYYYMMDD) 的 timeInt(HHMMSSmmm) 开始消费
+func WithStartTradingDay(tradingDay int, timeInt int) Option {
+	return WithStartTime(timescale.TradingTime(tradingDay, timeInt))
+}
+
+func WithEndTime(t time.Time) Option {
+	return func(consumer *Consumer) {
+		consumer.EndTime = t
+	}
+}
+
+// WithEndTradingDay 读到交易日 tradingDay(YYYYMMDD) 的 timeInt(HHMMSSmmm) 之后自动停止
+func WithEndTradingDay(tradingDay int, timeInt int) Option {
+	return WithEndTime(timescale.TradingTime(tradingDay, timeInt))
+}
+
+func WithEndOffset(offset int64) Option {
+	return func(consumer *Consumer) {
+		consumer.EndOffset = offset
+	}
+}
+
+func WithUntilHighWaterMark() Option {
+	return func(consumer *Consumer) {
+		consumer.UntilHighWaterMark = true
+	}
+}
+
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(consumer *Consumer) {
+		consumer.DrainTimeout = timeout
+	}
+}
+
+func WithDiscardOnStop() Option {
+	return func(consumer *Consumer) {
+		consumer.DiscardOnStop = true
+	}
+}
+
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(consumer *Consumer) {
+		consumer.ErrorHandler = handler
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(consumer *Consumer) {
+		consumer.Logger = logger
+	}
+}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(consumer *Consumer) {
+		consumer.RetryPolicy = policy
+	}
+}
+
+func WithConnStateCallback(cb ConnStateCallback) Option {
+	return func(consumer *Consumer) {
+		consumer.ConnStateCallback = cb
+	}
+}
+
+func WithShards(shards int, queueSize int) Option {
+	return func(consumer *Consumer) {
+		consumer.Shards = shards
+		consumer.ShardQueueSize = queueSize
+	}
+}
+
+// WithSymbolFilter 在解析前按 stock_id 过滤消息, 如 WithSymbolFilter(consumer.SymbolSuffix(".SH"))
+func WithSymbolFilter(filter SymbolFilter) Option {
+	return func(consumer *Consumer) {
+		consumer.SymbolFilter = filter
+	}
+}
+
+func WithCodec(cd codec.Codec) Option {
+	return func(consumer *Consumer) {
+		consumer.Codec = cd
+	}
+}
+
+// WithTopicCodec 指定 topic 的消息体编码, 消息带有 codec.Header 时以 header 为准
+func WithTopicCodec(topic string, cd codec.Codec) Option {
+	return func(consumer *Consumer) {
+		consumer.TopicCodecs[topic] = cd
+	}
+}
+
+/*
+WithPooling 复用解码用的 Snapshot/Order/Transaction/Index/MD/Meta 对象以减少 GC:
+回调返回后对象即被回收并用于下一条消息, 回调中需要保留的对象须先 Clone, 如 d.Clone(), meta.Clone();
+XXXBatchCallback 收到的 ds 与 metas 中的元素同样在回调返回后回收
+*/
+func WithPooling() Option {
+	return func(consumer *Consumer) {
+		consumer.Pooled = true
+	}
+}
+
+func WithSnapshotBatchCallback(cb SnapshotBatchCallback) Option {
+	return func(consumer *Consumer) {
+		consumer.SnapshotBatchCallback = cb
+	}
+}
+
+func WithOrderBatchCallback(cb OrderBatchCallback) Option {
+	return func(consumer *Consumer) {
+		consumer.OrderBatchCallback = cb
+	}
+}
+
+func WithTransactionBatchCallback(cb TransactionBatchCallback) Option {
+	return func(consumer *Consumer) {
+		consumer.TransactionBatchCallback = cb
+	}
+}
+
+func WithIndexBatchCallback(cb IndexBatchCallback) Option {
+	return func(consumer *Consumer) {
+		consumer.IndexBatchCallback = cb
+	}
+}
+
+// WithBatch 设置 XXXBatchCallback 每批最多 size 条, 第一条数据最多等待 linger 后投递
+func WithBatch(size int, linger time.Duration) Option {
+	return func(consumer *Consumer) {
+		consumer.BatchSize = size
+		consumer.BatchLinger = linger
+	}
+}
+
+// WithSnapshotConflation 即 WithOverflowPolicy(datatype.KeySnapshot, OverflowConflate): 回调处理不过来时,
+// 同一代码排队中的旧快照被新快照替换, 回调总是拿到最新的快照; 被替换的快照计入 QueueStats 的 Dropped
+func WithSnapshotConflation() Option {
+	return WithOverflowPolicy(datatype.KeySnapshot, OverflowConflate)
+}
+
+// WithGapDetector 在 MD 流投递前检查逐笔委托/成交的通道序号, 须同时使用 WithOrderedMD 与 WithMDCallback,
+// OrderCallback/TransactionCallback 等按类型的回调不经过检查
+func WithGapDetector(detector *GapDetector) Option {
+	return func(consumer *Consumer) {
+		consumer.GapDetector = detector
+	}
+}
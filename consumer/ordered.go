@@ -0,0 +1,165 @@
+package consumer
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type orderedItem struct {
+	m       *kafkago.Message
+	md      *datatype.MD
+	meta    *datatype.Meta
+	millis  int64 // 交易所时间, 自 00:00:00 起的毫秒数
+	channel int
+	seq     int64
+	arrival uint64 // 以上都相同时按到达顺序
+}
+
+// orderedQueue 按 (交易所时间, 通道, 通道内序号, 到达顺序) 排序的小顶堆
+type orderedQueue []*orderedItem
+
+func (q orderedQueue) Len() int { return len(q) }
+
+func (q orderedQueue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+	if a.millis != b.millis {
+		return a.millis < b.millis
+	}
+	if a.channel != b.channel {
+		return a.channel < b.channel
+	}
+	if a.seq != b.seq {
+		return a.seq < b.seq
+	}
+	return a.arrival < b.arrival
+}
+
+func (q orderedQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *orderedQueue) Push(x any) { *q = append(*q, x.(*orderedItem)) }
+
+func (q *orderedQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return item
+}
+
+// Sequence 返回逐笔数据的通道号与通道内序号: 有 BizIndex 时用 BizIndex(上交所),
+// 否则用委托号/成交编号(深交所委托与成交共用一个序列); 其它数据返回 0, 0
+func Sequence(md *datatype.MD) (int, int64) {
+	switch d := md.Data.(type) {
+	case *datatype.Order:
+		if d.BizIndex > 0 {
+			return d.Channel, d.BizIndex
+		}
+		return d.Channel, int64(d.Order)
+	case *datatype.Transaction:
+		if d.BizIndex > 0 {
+			return d.Channel, d.BizIndex
+		}
+		return d.Channel, int64(d.Index)
+	}
+	return 0, 0
+}
+
+func (c *Consumer) deliverMD(md *datatype.MD, meta *datatype.Meta) {
+	if c.GapDetector != nil && !c.GapDetector.Check(md, meta) {
+		return
+	}
+	if c.MDCallback != nil {
+		c.MDCallback(md, meta)
+	}
+	if c.MDTiMgr != nil {
+		c.MDTiMgr.Update(timescale.IntTime2Time(meta.MDTime))
+	}
+}
+
+// startOrderedHandler 启动按交易所时间排序投递 MD 的 handler: 消息在队列中等待,
+// 直到见过的最大交易所时间超过它 OrderedWindow, 或 OrderedWindow 内没有新消息
+func (c *Consumer) startOrderedHandler() chan *kafkago.Message {
+	ch := make(chan *kafkago.Message, c.ChanSize)
+	in := c.input(datatype.KeyMD, ch)
+	window := c.OrderedWindow.Milliseconds()
+
+	c.handlers.Add(1)
+	go func() {
+		defer c.handlers.Done()
+
+		queue := &orderedQueue{}
+		var arrival uint64
+		var maxMillis int64
+
+		deliver := func(all bool) {
+			for queue.Len() > 0 && (all || (*queue)[0].millis <= maxMillis-window) {
+				item := heap.Pop(queue).(*orderedItem)
+				c.deliverMD(item.md, item.meta)
+				c.release(item.md, item.meta)
+				c.ack(item.m)
+			}
+		}
+
+		idle := time.NewTimer(c.OrderedWindow)
+		defer idle.Stop()
+
+		for {
+			select {
+			case <-c.abortChan:
+				c.unsentMtx.Lock()
+				c.unsent[datatype.KeyMD] += queue.Len()
+				c.unsentMtx.Unlock()
+				return
+			default:
+			}
+
+			select {
+			case m, ok := <-in:
+				if !ok {
+					deliver(true)
+					return
+				}
+
+				md, meta := c.acquire(keyOf(m))
+				if _, _, err := c.parseMD(m, md, meta); err != nil {
+					c.onError(err)
+					c.release(md, meta)
+					c.ack(m)
+					continue
+				}
+
+				item := &orderedItem{m: m, md: md, meta: meta, arrival: arrival}
+				item.millis = timescale.IntTime2Millis(meta.MDTime)
+				item.channel, item.seq = Sequence(md)
+				arrival++
+				heap.Push(queue, item)
+
+				if item.millis > maxMillis {
+					maxMillis = item.millis
+				}
+				deliver(false)
+
+				if !idle.Stop() {
+					select {
+					case <-idle.C:
+					default:
+					}
+				}
+				idle.Reset(c.OrderedWindow)
+			case <-idle.C:
+				deliver(true)
+				idle.Reset(c.OrderedWindow)
+			case <-c.abortChan:
+				c.unsentMtx.Lock()
+				c.unsent[datatype.KeyMD] += queue.Len()
+				c.unsentMtx.Unlock()
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,79 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func orderMessage(offset int64, time int, seq int) *kafkago.Message {
+	return &kafkago.Message{Offset: offset, Key: []byte(datatype.KeyOrder), Value: []byte(fmt.Sprintf(
+		`{"type":2,"data":{"stock_id":"000001.SZ","time":%d,"order":%d,"price":11.37,"volume":100,"order_kind":"2","function_code":"B","channel":2011}}`, time, seq))}
+}
+
+func transactionMessage(offset int64, time int, seq int, bidOrder int) *kafkago.Message {
+	return &kafkago.Message{Offset: offset, Key: []byte(datatype.KeyTransaction), Value: []byte(fmt.Sprintf(
+		`{"type":3,"data":{"stock_id":"000001.SZ","time":%d,"index":%d,"price":11.37,"volume":100,"function_code":"0","ask_order":1,"bid_order":%d,"channel":2011}}`, time, seq, bidOrder))}
+}
+
+func TestOrderedMD(t *testing.T) {
+	var offsets []int64
+	c := newConsumer(nil, WithOrderedMD(time.Second), WithMDCallback(func(d *datatype.MD, meta *datatype.Meta) {
+		offsets = append(offsets, meta.Offset)
+	}))
+	c.Handle()
+
+	// 成交先于引起它的委托到达, 同一毫秒内按通道序号排序
+	messages := []*kafkago.Message{
+		transactionMessage(0, 93000100, 11, 10),
+		orderMessage(1, 93000100, 10),
+		snapshotMessage(2), // 93000000
+		orderMessage(3, 93000050, 9),
+	}
+	for _, m := range messages {
+		c.dispatch(context.Background(), m)
+	}
+	if err := c.drain(false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{2, 3, 1, 0}
+	if fmt.Sprint(offsets) != fmt.Sprint(want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+}
+
+func TestOrderedMDWindow(t *testing.T) {
+	delivered := make(chan int64, 10)
+	c := newConsumer(nil, WithOrderedMD(50*time.Millisecond), WithMDCallback(func(d *datatype.MD, meta *datatype.Meta) {
+		delivered <- meta.Offset
+	}))
+	c.Handle()
+	defer c.drain(false)
+
+	ctx := context.Background()
+	c.dispatch(ctx, orderMessage(0, 93000000, 1))
+	c.dispatch(ctx, orderMessage(1, 93000020, 2))
+	// 交易所时间推进超过窗口, 之前的消息可以投递
+	c.dispatch(ctx, orderMessage(2, 93000100, 3))
+
+	for _, want := range []int64{0, 1} {
+		if got := <-delivered; got != want {
+			t.Fatalf("delivered offset %d, want %d", got, want)
+		}
+	}
+
+	// 最后一条在窗口时间内没有新消息后投递
+	select {
+	case got := <-delivered:
+		if got != 2 {
+			t.Errorf("delivered offset %d, want 2", got)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("last message is not flushed after idle window")
+	}
+}
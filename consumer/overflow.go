@@ -0,0 +1,245 @@
+package consumer
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// OverflowPolicy 决定 channel 已满时如何处理新消息, 被丢弃的消息仍视为已处理, consumer group 模式下照常提交
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // 阻塞拉取, 直到 handler 取走消息(默认)
+	OverflowDropNewest                       // 丢弃新消息
+	OverflowDropOldest                       // 丢弃 channel 中最早的消息
+	OverflowConflate                         // 排队中同一代码只保留最新的一条, 适用于 snapshot/index 等全量数据, 见 conflatePipe
+)
+
+// QueueStats 是一种数据的 channel 状态
+type QueueStats struct {
+	Len     int   // 排队中的消息数, 含分片 worker 的队列与合并队列
+	Cap     int   // channel 容量
+	Dropped int64 // 按 OverflowPolicy 丢弃的消息数
+}
+
+// overflow 保存各 channel 的丢弃计数与合并队列中的消息数
+type overflow struct {
+	dropped map[string]*atomic.Int64
+	pending map[string]*atomic.Int64
+}
+
+func newOverflow() *overflow {
+	o := &overflow{
+		dropped: make(map[string]*atomic.Int64),
+		pending: make(map[string]*atomic.Int64),
+	}
+	for _, key := range []string{datatype.KeySnapshot, datatype.KeyOrder, datatype.KeyTransaction, datatype.KeyIndex, datatype.KeyMD} {
+		o.dropped[key] = &atomic.Int64{}
+		o.pending[key] = &atomic.Int64{}
+	}
+	return o
+}
+
+func (c *Consumer) drop(key string, m *kafkago.Message) {
+	c.overflow.dropped[key].Add(1)
+	c.ack(m)
+}
+
+// sendOverflow 按 key 的 OverflowPolicy 发送, OverflowBlock 与 OverflowConflate 时返回 false 由 send 阻塞发送,
+// OverflowConflate 的合并在 channel 之后的 conflatePipe 中进行
+func (c *Consumer) sendOverflow(ctx context.Context, key string, ch chan *kafkago.Message, m *kafkago.Message) bool {
+	switch c.Overflow[key] {
+	case OverflowDropNewest:
+		select {
+		case ch <- m:
+		default:
+			c.drop(key, m)
+		}
+		return true
+	case OverflowDropOldest:
+		for {
+			select {
+			case ch <- m:
+				return true
+			default:
+			}
+			select {
+			case old := <-ch:
+				c.drop(key, old)
+			default:
+			}
+		}
+	}
+	return false
+}
+
+type conflateKey struct {
+	key     string
+	stockID string
+}
+
+// QueueStats 返回各已创建 channel 的状态, 以 datatype.KeyXXX 为 key
+func (c *Consumer) QueueStats() map[string]QueueStats {
+	stats := make(map[string]QueueStats)
+	for key, ch := range c.chans() {
+		s := QueueStats{
+			Len:     len(ch) + int(c.overflow.pending[key].Load()),
+			Cap:     cap(ch),
+			Dropped: c.overflow.dropped[key].Load(),
+		}
+		for _, shard := range c.shardChans[key] {
+			s.Len += len(shard)
+		}
+		stats[key] = s
+	}
+	return stats
+}
+
+// conflateQueue 是按 (key, stock_id) 合并的 FIFO 队列, 同一代码只保留最新的一条, 位置不变
+type conflateQueue struct {
+	items []*conflateItem
+	index map[conflateKey]*conflateItem
+}
+
+type conflateItem struct {
+	k  conflateKey
+	ok bool // 取到了代码
+	m  *kafkago.Message
+}
+
+func newConflateQueue() *conflateQueue {
+	return &conflateQueue{index: make(map[conflateKey]*conflateItem)}
+}
+
+func (q *conflateQueue) len() int {
+	return len(q.items)
+}
+
+// push 放入 m 并返回被替换的旧消息; full 时只做替换, 需要新增一项时返回 ok == false
+func (q *conflateQueue) push(c *Consumer, m *kafkago.Message, full bool) (replaced *kafkago.Message, ok bool) {
+	item := &conflateItem{m: m}
+	var stockID string
+	if stockID, item.ok = c.peekStockID(m); item.ok {
+		item.k = conflateKey{key: keyOf(m), stockID: stockID}
+		if old, ok := q.index[item.k]; ok {
+			replaced = old.m
+			old.m = m
+			return replaced, true
+		}
+	}
+	if full {
+		return nil, false
+	}
+	if item.ok {
+		q.index[item.k] = item
+	}
+	q.items = append(q.items, item)
+	return nil, true
+}
+
+func (q *conflateQueue) pop() *kafkago.Message {
+	item := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	if item.ok {
+		delete(q.index, item.k)
+	}
+	return item.m
+}
+
+func (q *conflateQueue) front() *kafkago.Message {
+	return q.items[0].m
+}
+
+// input 返回 worker 读取 key 的消息所用的 channel: OverflowConflate 时为 conflatePipe 的输出, 否则就是 ch
+func (c *Consumer) input(key string, ch chan *kafkago.Message) chan *kafkago.Message {
+	if c.Overflow[key] != OverflowConflate {
+		return ch
+	}
+	return c.conflatePipe(key, ch)
+}
+
+/*
+conflatePipe 启动一个 goroutine 不断取走 in 中的消息放入 conflateQueue, 再逐条交给返回的无缓冲 channel:
+worker 处理不过来时, 同一 (key, stock_id) 排队中的旧消息被新消息替换并计为丢弃, worker 总是拿到最新的数据.
+每条消息只做一次 map 操作. 队列中已有 ChanSize 条(代码数多于 ChanSize, 或取不到代码的消息积压)时仍可合并,
+但需要新增一项的消息会留在 held 中, 此时不再读取 in, 发送方照常阻塞
+*/
+func (c *Consumer) conflatePipe(key string, in chan *kafkago.Message) chan *kafkago.Message {
+	out := make(chan *kafkago.Message)
+	limit := int(c.ChanSize)
+	if limit < 1 {
+		limit = 1
+	}
+
+	c.handlers.Add(1)
+	go func() {
+		defer c.handlers.Done()
+		defer close(out)
+
+		q := newConflateQueue()
+		pending := c.overflow.pending[key]
+		var held *kafkago.Message // 队列已满且不能合并的消息, 等队列有空位时放入
+		push := func(m *kafkago.Message) {
+			replaced, ok := q.push(c, m, q.len() >= limit)
+			if !ok {
+				held = m
+				return
+			}
+			if replaced != nil {
+				c.drop(key, replaced)
+			}
+		}
+
+		for {
+			var recv, send chan *kafkago.Message
+			var front *kafkago.Message
+			if in != nil && held == nil {
+				recv = in
+			}
+			if q.len() > 0 {
+				send, front = out, q.front()
+			} else if in == nil {
+				return
+			}
+
+			select {
+			case m, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				pending.Add(1)
+				push(m)
+				if held == nil && q.len() == 0 {
+					continue
+				}
+			case send <- front:
+				q.pop()
+				if held != nil {
+					m := held
+					held = nil
+					push(m)
+				}
+			case <-c.abortChan:
+				n := q.len()
+				if held != nil {
+					n++
+				}
+				c.unsentMtx.Lock()
+				c.unsent[key] += n
+				c.unsentMtx.Unlock()
+				pending.Add(int64(-n))
+				return
+			}
+			pending.Store(int64(q.len()))
+			if held != nil {
+				pending.Add(1)
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,80 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func symbolSnapshot(offset int64, stockID string) *kafkago.Message {
+	return &kafkago.Message{Key: []byte(datatype.KeySnapshot), Offset: offset, Value: []byte(fmt.Sprintf(
+		`{"type":1,"data":{"stock_id":"%s","time":93000000}}`, stockID))}
+}
+
+// waitDropped 等待 key 的丢弃数达到 n, 合并在 conflatePipe 中异步进行
+func waitDropped(t *testing.T, c *Consumer, key string, n int64) {
+	deadline := time.Now().Add(time.Second)
+	for c.QueueStats()[key].Dropped < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("dropped = %d, want %d", c.QueueStats()[key].Dropped, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// runOverflow 在回调阻塞于第一条消息时发送 messages, 返回投递的 offset
+func runOverflow(t *testing.T, policy OverflowPolicy, messages []*kafkago.Message) ([]int64, QueueStats) {
+	entered := make(chan struct{}, 1)
+	block := make(chan struct{})
+	var offsets []int64
+	c := newConsumer(nil, WithChanSize(3), WithOverflowPolicy(datatype.KeySnapshot, policy), WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+		if meta.Offset == 0 {
+			entered <- struct{}{}
+			<-block
+		}
+		offsets = append(offsets, meta.Offset)
+	}))
+	c.Handle()
+
+	ctx := context.Background()
+	c.dispatch(ctx, symbolSnapshot(0, "000001.SZ"))
+	<-entered
+	for _, m := range messages {
+		c.dispatch(ctx, m)
+	}
+	waitDropped(t, c, datatype.KeySnapshot, 3)
+	close(block)
+	if err := c.drain(true); err != nil {
+		t.Fatal(err)
+	}
+	return offsets, c.QueueStats()[datatype.KeySnapshot]
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	var messages []*kafkago.Message
+	for i, stockID := range []string{"000001.SZ", "000002.SZ", "000001.SZ", "000003.SZ", "000002.SZ", "000001.SZ"} {
+		messages = append(messages, symbolSnapshot(int64(i+1), stockID))
+	}
+
+	for _, tt := range []struct {
+		policy OverflowPolicy
+		want   string
+	}{
+		{OverflowDropNewest, "[0 1 2 3]"},
+		{OverflowDropOldest, "[0 4 5 6]"},
+		// 排队中同一代码合并, 代码保持第一次出现的顺序
+		{OverflowConflate, "[0 6 5 4]"},
+	} {
+		offsets, stats := runOverflow(t, tt.policy, messages)
+		if fmt.Sprint(offsets) != tt.want {
+			t.Errorf("policy %d: offsets = %v, want %s", tt.policy, offsets, tt.want)
+		}
+		if stats.Dropped != 3 || stats.Cap != 3 {
+			t.Errorf("policy %d: stats = %+v, want 3 dropped", tt.policy, stats)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package consumer
+
+import (
+	"sync"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+var (
+	mdPool          = sync.Pool{New: func() any { return &datatype.MD{} }}
+	metaPool        = sync.Pool{New: func() any { return &datatype.Meta{} }}
+	snapshotPool    = sync.Pool{New: func() any { return newPooledSnapshot() }}
+	orderPool       = sync.Pool{New: func() any { return &datatype.Order{} }}
+	transactionPool = sync.Pool{New: func() any { return &datatype.Transaction{} }}
+	indexPool       = sync.Pool{New: func() any { return &datatype.Index{} }}
+)
+
+// pooledSnapshot 是对象池中的 Snapshot, 各档位切片指向 levels, 解码不超过 MaxLevels 档时不再分配内存
+type pooledSnapshot struct {
+	snapshot datatype.Snapshot
+	levels   [4][datatype.MaxLevels]float64
+}
+
+func newPooledSnapshot() *datatype.Snapshot {
+	p := &pooledSnapshot{}
+	p.snapshot.AskPrices = p.levels[0][:0]
+	p.snapshot.AskVolumes = p.levels[1][:0]
+	p.snapshot.BidPrices = p.levels[2][:0]
+	p.snapshot.BidVolumes = p.levels[3][:0]
+	return &p.snapshot
+}
+
+// resetSnapshot 清空 s 以便复用, 保留各档位切片的底层数组
+func resetSnapshot(s *datatype.Snapshot) {
+	*s = datatype.Snapshot{
+		AskPrices:  s.AskPrices[:0],
+		AskVolumes: s.AskVolumes[:0],
+		BidPrices:  s.BidPrices[:0],
+		BidVolumes: s.BidVolumes[:0],
+	}
+}
+
+// keyOf 对已知的 key 返回常量, 避免每条消息分配字符串
+func keyOf(m *kafkago.Message) string {
+	switch string(m.Key) {
+	case datatype.KeySnapshot:
+		return datatype.KeySnapshot
+	case datatype.KeyOrder:
+		return datatype.KeyOrder
+	case datatype.KeyTransaction:
+		return datatype.KeyTransaction
+	case datatype.KeyIndex:
+		return datatype.KeyIndex
+	}
+	return string(m.Key)
+}
+
+// newData 返回 key 对应的数据对象, 未知 key 返回 nil
+func newData(key string) interface{} {
+	switch key {
+	case datatype.KeySnapshot:
+		return &datatype.Snapshot{}
+	case datatype.KeyOrder:
+		return &datatype.Order{}
+	case datatype.KeyTransaction:
+		return &datatype.Transaction{}
+	case datatype.KeyIndex:
+		return &datatype.Index{}
+	}
+	return nil
+}
+
+// acquire 返回解码 key 对应数据所需的 md 与 meta, Pooled 时从对象池中取出
+func (c *Consumer) acquire(key string) (*datatype.MD, *datatype.Meta) {
+	if !c.Pooled {
+		return &datatype.MD{Data: newData(key)}, &datatype.Meta{}
+	}
+
+	md := mdPool.Get().(*datatype.MD)
+	switch key {
+	case datatype.KeySnapshot:
+		snapshot := snapshotPool.Get().(*datatype.Snapshot)
+		resetSnapshot(snapshot)
+		md.Data = snapshot
+	case datatype.KeyOrder:
+		order := orderPool.Get().(*datatype.Order)
+		*order = datatype.Order{}
+		md.Data = order
+	case datatype.KeyTransaction:
+		transaction := transactionPool.Get().(*datatype.Transaction)
+		*transaction = datatype.Transaction{}
+		md.Data = transaction
+	case datatype.KeyIndex:
+		index := indexPool.Get().(*datatype.Index)
+		*index = datatype.Index{}
+		md.Data = index
+	default:
+		md.Data = nil
+	}
+	return md, metaPool.Get().(*datatype.Meta)
+}
+
+// release 在回调返回后把 acquire 取出的对象放回对象池
+func (c *Consumer) release(md *datatype.MD, meta *datatype.Meta) {
+	if !c.Pooled {
+		return
+	}
+
+	switch d := md.Data.(type) {
+	case *datatype.Snapshot:
+		snapshotPool.Put(d)
+	case *datatype.Order:
+		orderPool.Put(d)
+	case *datatype.Transaction:
+		transactionPool.Put(d)
+	case *datatype.Index:
+		indexPool.Put(d)
+	}
+	md.Data = nil
+	mdPool.Put(md)
+	metaPool.Put(meta)
+}
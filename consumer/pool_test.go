@@ -0,0 +1,77 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const benchSnapshot = `{"type":1,"data":{"stock_id":"000001.SZ","trading_day":20230823,"time":92018000,"status":"I","prevclose":11.37,"open":0.0,"high":0.0,"low":0.0,"match":0.0,"ask_prices":[11.37,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0],"ask_volumes":[9.79,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0],"bid_prices":[11.37,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0],"bid_volumes":[9.79,0.9,0.0,0.0,0.0,0.0,0.0,0.0,0.0,0.0],"trades_num":0,"volume":0,"turnover":0,"total_ask_volume":0,"total_bid_volume":0,"weighted_avg_ask_price":0.0,"weighted_avg_bid_price":0.0,"iopv":0,"high_limited":12.51,"low_limited":10.23}}`
+
+func TestPooling(t *testing.T) {
+	var kept []*datatype.Snapshot
+	c := newConsumer(nil, WithPooling(), WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+		kept = append(kept, d.Clone())
+	}))
+	c.Handle()
+
+	for i := 0; i < 3; i++ {
+		c.dispatch(context.Background(), snapshotMessage(int64(i)))
+	}
+	if err := c.drain(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kept) != 3 {
+		t.Fatalf("delivered %d, want 3", len(kept))
+	}
+	for _, d := range kept {
+		if d.StockID != "000001.SZ" || d.Match != 11.37 {
+			t.Errorf("snapshot = %+v", d)
+		}
+	}
+
+	c.SnapshotCallback = func(d *datatype.Snapshot, meta *datatype.Meta) {}
+	m := &kafkago.Message{Key: []byte(datatype.KeySnapshot), Value: []byte(benchSnapshot)}
+	allocs := testing.AllocsPerRun(100, func() {
+		c.handleSnapshot(m)
+	})
+	if allocs >= 1 {
+		t.Errorf("allocs = %.1f, want 0", allocs)
+	}
+}
+
+// BenchmarkStdJSON 是改用 codec 之前 ParseSnapshot 的做法
+func BenchmarkStdJSON(b *testing.B) {
+	value := []byte(benchSnapshot)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		md := &datatype.MD{Data: &datatype.Snapshot{}}
+		if err := json.Unmarshal(value, md); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseSnapshot(b *testing.B) {
+	c := newConsumer(nil)
+	m := &kafkago.Message{Key: []byte(datatype.KeySnapshot), Value: []byte(benchSnapshot)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := c.ParseSnapshot(m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHandleSnapshotPooled(b *testing.B) {
+	c := newConsumer(nil, WithPooling(), WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {}))
+	m := &kafkago.Message{Key: []byte(datatype.KeySnapshot), Value: []byte(benchSnapshot)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.handleSnapshot(m)
+	}
+}
@@ -0,0 +1,164 @@
+package consumer
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+type RetryPolicy struct {
+	InitialBackoff  time.Duration
+	MaxBackoff      time.Duration
+	Multiplier      float64
+	Jitter          float64 // 退避时间随机浮动的比例, 0~1
+	MaxAttempts     int     // 连续失败次数上限, 超过后 Run 返回错误, 0 表示一直重试
+	DisconnectAfter int     // 连续失败多少次后视为断开(ConnDisconnected)
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	InitialBackoff:  100 * time.Millisecond,
+	MaxBackoff:      10 * time.Second,
+	Multiplier:      2,
+	Jitter:          0.2,
+	MaxAttempts:     0,
+	DisconnectAfter: 5,
+}
+
+// Backoff 返回第 attempt(从 1 开始) 次失败后的等待时间
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt && backoff < float64(p.MaxBackoff); i++ {
+		backoff *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+type ConnState int
+
+const (
+	ConnConnected    ConnState = iota // 首次收到消息
+	ConnDegraded                      // 拉取出错, 正在重试
+	ConnDisconnected                  // 连续失败达到 RetryPolicy.DisconnectAfter 次
+	ConnRecovered                     // 出错后重新收到消息
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnected:
+		return "connected"
+	case ConnDegraded:
+		return "degraded"
+	case ConnDisconnected:
+		return "disconnected"
+	case ConnRecovered:
+		return "recovered"
+	}
+	return "unknown"
+}
+
+type ConnEvent struct {
+	State     ConnState
+	Topic     string
+	Partition int
+	Attempts  int   // 连续失败次数
+	Err       error // 最近一次拉取错误
+
+	// 以下只在 ConnRecovered 时有效
+	LastOffset int64 // 出错前最后一条消息的 offset, -1 表示此前没有收到过消息
+	Offset     int64 // 恢复后第一条消息的 offset
+	Gap        int64 // 恢复前后跳过的消息数
+}
+
+type ConnStateCallback func(ev ConnEvent)
+
+// connTracker 记录一个 reader 的连接状态, 只在该 reader 的 readLoop 中使用
+type connTracker struct {
+	c         *Consumer
+	topic     string
+	partition int
+
+	connected   bool
+	failures    int
+	lastErr     error
+	lastOffsets map[int]int64 // partition => 最后一条消息的 offset, consumer group 下一个 reader 对应多个 partition
+}
+
+func (c *Consumer) newConnTracker(topic string, partition int) *connTracker {
+	return &connTracker{
+		c:           c,
+		topic:       topic,
+		partition:   partition,
+		lastOffsets: make(map[int]int64),
+	}
+}
+
+func (t *connTracker) notify(ev ConnEvent) {
+	if t.c.ConnStateCallback != nil {
+		t.c.ConnStateCallback(ev)
+	}
+}
+
+// failed 记录一次拉取错误并等待退避时间, 返回 false 表示应当放弃
+func (t *connTracker) failed(ctx context.Context, err error) bool {
+	policy := t.c.RetryPolicy
+
+	t.failures++
+	t.lastErr = err
+	switch t.failures {
+	case 1:
+		t.notify(ConnEvent{State: ConnDegraded, Topic: t.topic, Partition: t.partition, Attempts: t.failures, Err: err})
+	case policy.DisconnectAfter:
+		t.notify(ConnEvent{State: ConnDisconnected, Topic: t.topic, Partition: t.partition, Attempts: t.failures, Err: err})
+	}
+
+	if policy.MaxAttempts > 0 && t.failures >= policy.MaxAttempts {
+		return false
+	}
+
+	timer := time.NewTimer(policy.Backoff(t.failures))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// received 在成功收到一条消息后调用
+func (t *connTracker) received(partition int, offset int64) {
+	lastOffset, ok := t.lastOffsets[partition]
+	if !ok {
+		lastOffset = -1
+	}
+
+	switch {
+	case t.failures > 0:
+		ev := ConnEvent{
+			State:      ConnRecovered,
+			Topic:      t.topic,
+			Partition:  partition,
+			Attempts:   t.failures,
+			Err:        t.lastErr,
+			LastOffset: lastOffset,
+			Offset:     offset,
+		}
+		if lastOffset >= 0 {
+			ev.Gap = offset - lastOffset - 1
+		}
+		t.notify(ev)
+	case !t.connected:
+		t.notify(ConnEvent{State: ConnConnected, Topic: t.topic, Partition: partition, LastOffset: -1, Offset: offset})
+	}
+
+	t.connected = true
+	t.failures = 0
+	t.lastErr = nil
+	t.lastOffsets[partition] = offset
+}
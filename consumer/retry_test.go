@@ -0,0 +1,58 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		if got := policy.Backoff(attempt); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestConnTracker(t *testing.T) {
+	var states []ConnState
+	var recovered ConnEvent
+	c := newConsumer(nil,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 4, DisconnectAfter: 2}),
+		WithConnStateCallback(func(ev ConnEvent) {
+			states = append(states, ev.State)
+			if ev.State == ConnRecovered {
+				recovered = ev
+			}
+		}),
+	)
+
+	ctx := context.Background()
+	conn := c.newConnTracker("transaction", 0)
+	conn.received(0, 100)
+	conn.failed(ctx, errors.New("broker down"))
+	conn.failed(ctx, errors.New("broker down"))
+	conn.received(0, 105)
+
+	want := []ConnState{ConnConnected, ConnDegraded, ConnDisconnected, ConnRecovered}
+	if len(states) != len(want) {
+		t.Fatalf("states = %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("states = %v, want %v", states, want)
+		}
+	}
+	if recovered.Gap != 4 || recovered.LastOffset != 100 || recovered.Offset != 105 {
+		t.Errorf("recovered = %+v", recovered)
+	}
+
+	for i := 0; i < 3; i++ {
+		conn.failed(ctx, errors.New("broker down"))
+	}
+	if conn.failed(ctx, errors.New("broker down")) {
+		t.Errorf("retry should give up after MaxAttempts")
+	}
+}
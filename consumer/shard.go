@@ -0,0 +1,65 @@
+package consumer
+
+import (
+	"hash/fnv"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const DefaultShardQueueSize = 100000
+
+// startShards 启动一个路由 goroutine 与 Shards 个 worker, 路由只从消息体中取出 stock_id 计算分片,
+// 解析与回调都在 worker 中进行; 同一 StockID 总在同一个 worker 中, 因此保持顺序
+func (c *Consumer) startShards(key string, ch chan *kafkago.Message, startWorker func(ch chan *kafkago.Message)) {
+	shards := make([]chan *kafkago.Message, c.Shards)
+	for i := range shards {
+		shards[i] = make(chan *kafkago.Message, c.ShardQueueSize)
+		startWorker(shards[i])
+	}
+	c.shardChans[key] = shards
+
+	c.handlers.Add(1)
+	go func() {
+		defer c.handlers.Done()
+		for {
+			select {
+			case <-c.abortChan:
+				return
+			default:
+			}
+
+			select {
+			case m, ok := <-ch:
+				if !ok {
+					for _, shard := range shards {
+						close(shard)
+					}
+					return
+				}
+
+				select {
+				case shards[c.shardOf(m, len(shards))] <- m:
+				case <-c.abortChan:
+					c.unsentMtx.Lock()
+					c.unsent[key]++
+					c.unsentMtx.Unlock()
+					return
+				}
+			case <-c.abortChan:
+				return
+			}
+		}
+	}()
+}
+
+// shardOf 取不到 stock_id 的消息都分到第 0 个分片
+func (c *Consumer) shardOf(m *kafkago.Message, n int) int {
+	stockID, ok := c.peekStockID(m)
+	if !ok {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(stockID))
+	return int(h.Sum32() % uint32(n))
+}
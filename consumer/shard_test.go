@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestShards(t *testing.T) {
+	var mtx sync.Mutex
+	offsets := make(map[string][]int64)
+	c := newConsumer(nil, WithShards(4, 100), WithSnapshotCallback(func(d *datatype.Snapshot, meta *datatype.Meta) {
+		mtx.Lock()
+		offsets[d.StockID] = append(offsets[d.StockID], meta.Offset)
+		mtx.Unlock()
+	}))
+	c.Handle()
+
+	const symbols, n = 8, 50
+	for i := 0; i < symbols*n; i++ {
+		value := fmt.Sprintf(`{"type":1,"data":{"stock_id":"%06d.SZ","time":93000000}}`, i%symbols)
+		m := &kafkago.Message{Key: []byte(datatype.KeySnapshot), Offset: int64(i), Value: []byte(value)}
+		if err := c.dispatch(context.Background(), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.drain(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(offsets) != symbols {
+		t.Fatalf("symbols = %d, want %d", len(offsets), symbols)
+	}
+	for stockID, list := range offsets {
+		if len(list) != n {
+			t.Errorf("%s delivered %d, want %d", stockID, len(list), n)
+		}
+		for i := 1; i < len(list); i++ {
+			if list[i] <= list[i-1] {
+				t.Errorf("%s out of order: %v", stockID, list)
+				break
+			}
+		}
+	}
+}
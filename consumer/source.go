@@ -0,0 +1,40 @@
+package consumer
+
+import (
+	"context"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// Source 产生带 key 和 offset 的原始消息, 数据读完时 FetchMessage 返回 io.EOF;
+// 只影响一条消息或一个文件的错误返回 *DecodeError 或 *FileError, Consumer 交给 ErrorHandler 后继续读取, 不计入 RetryPolicy.
+// *kafkago.Reader 即是一种 Source
+type Source interface {
+	FetchMessage(ctx context.Context) (kafkago.Message, error)
+	Close() error
+}
+
+// Committer 由支持提交 offset 的 Source 实现, 如 consumer group 模式的 *kafkago.Reader
+type Committer interface {
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+}
+
+// NewSourceConsumer 从任意 Source 读取消息, 回调与 TiMgr 的用法与 NewConsumer 相同;
+// 与 kafka 相关的 Option(如 WithGroupID, WithStartTime 的 offset 查询)对其无效
+func NewSourceConsumer(source Source, opts ...Option) *Consumer {
+	consumer := newConsumer(nil, opts...)
+	consumer.sources = append(consumer.sources, source)
+	return consumer
+}
+
+// sourceName 返回用于错误信息的 topic 与 partition
+func sourceName(source Source) (string, int) {
+	switch s := source.(type) {
+	case *kafkago.Reader:
+		config := s.Config()
+		return config.Topic, config.Partition
+	case *FileSource:
+		return s.Name(), -1
+	}
+	return "", -1
+}
@@ -0,0 +1,57 @@
+package datatype
+
+// MaxLevels 是快照的档位数
+const MaxLevels = 10
+
+func cloneFloats(v []float64) []float64 {
+	if v == nil {
+		return nil
+	}
+	return append(make([]float64, 0, len(v)), v...)
+}
+
+// Clone 返回不与 s 共享内存的副本, 复用模式下回调返回后仍要使用 Snapshot 时需先 Clone
+func (s *Snapshot) Clone() *Snapshot {
+	clone := *s
+	clone.AskPrices = cloneFloats(s.AskPrices)
+	clone.AskVolumes = cloneFloats(s.AskVolumes)
+	clone.BidPrices = cloneFloats(s.BidPrices)
+	clone.BidVolumes = cloneFloats(s.BidVolumes)
+	return &clone
+}
+
+func (o *Order) Clone() *Order {
+	clone := *o
+	return &clone
+}
+
+func (t *Transaction) Clone() *Transaction {
+	clone := *t
+	return &clone
+}
+
+func (i *Index) Clone() *Index {
+	clone := *i
+	return &clone
+}
+
+func (m *Meta) Clone() *Meta {
+	clone := *m
+	return &clone
+}
+
+// Clone 同时复制 Data
+func (md *MD) Clone() *MD {
+	clone := &MD{Type: md.Type, Data: md.Data}
+	switch d := md.Data.(type) {
+	case *Snapshot:
+		clone.Data = d.Clone()
+	case *Order:
+		clone.Data = d.Clone()
+	case *Transaction:
+		clone.Data = d.Clone()
+	case *Index:
+		clone.Data = d.Clone()
+	}
+	return clone
+}
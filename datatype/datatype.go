@@ -3,7 +3,7 @@ package datatype
 const (
 	OrderFuncBuy  = "B"
 	OrderFuncSell = "S"
-	OrderFunKnown = "C"
+	OrderFunKnown = "C" // 深交所撤单在逐笔成交中(TransactionFuncCancel), 上交所撤单见 OrderKindDel
 )
 
 const (
@@ -15,6 +15,13 @@ const (
 	//OrderKindUtp = "2" // 即时成交
 )
 
+// 上交所逐笔委托的 OrderKind: 新增与删除(撤单)都在委托流中, OrderOriNo 为原始订单号, 成交的 BidOrder/AskOrder 引用它
+const (
+	OrderKindAdd    = "A" // 新增委托, Volume 为主动成交后剩余挂单的数量
+	OrderKindDel    = "D" // 删除委托, Volume 为撤单数量
+	OrderKindStatus = "S" // 产品状态
+)
+
 const (
 	TransactionFuncCancel = "C" // 撤单
 	TransactionFuncTrans  = "0" // 成交
@@ -48,9 +55,11 @@ type MD struct {
 }
 
 type Meta struct {
-	Key    string
-	Offset int64
-	MDTime int
+	Key       string
+	Topic     string
+	Partition int
+	Offset    int64
+	MDTime    int
 }
 
 /*
@@ -4,6 +4,7 @@ go 1.21.0
 
 require (
 	github.com/golang-module/carbon v1.7.3
+	github.com/klauspost/compress v1.15.9
 	github.com/segmentio/kafka-go v0.4.42
 )
 
@@ -12,7 +13,6 @@ require (
 	github.com/gobuffalo/packd v0.3.0 // indirect
 	github.com/gobuffalo/packr v1.30.1 // indirect
 	github.com/joho/godotenv v1.3.0 // indirect
-	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	github.com/rogpeppe/go-internal v1.3.0 // indirect
 	github.com/xdg-go/pbkdf2 v1.0.0 // indirect
@@ -0,0 +1,50 @@
+package recorder
+
+import (
+	"log/slog"
+	"time"
+)
+
+type Option func(recorder *Recorder)
+
+func WithPrefix(prefix string) Option {
+	return func(recorder *Recorder) {
+		recorder.Prefix = prefix
+	}
+}
+
+func WithMaxFileSize(size int64) Option {
+	return func(recorder *Recorder) {
+		recorder.MaxFileSize = size
+	}
+}
+
+func WithCompression(compression string) Option {
+	return func(recorder *Recorder) {
+		recorder.Compression = compression
+	}
+}
+
+func WithFlushInterval(interval time.Duration) Option {
+	return func(recorder *Recorder) {
+		recorder.FlushInterval = interval
+	}
+}
+
+func WithIndexInterval(interval time.Duration) Option {
+	return func(recorder *Recorder) {
+		recorder.IndexInterval = interval
+	}
+}
+
+func WithErrorHandler(handler func(err error)) Option {
+	return func(recorder *Recorder) {
+		recorder.ErrorHandler = handler
+	}
+}
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(recorder *Recorder) {
+		recorder.Logger = logger
+	}
+}
@@ -0,0 +1,369 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/2997215859/gomdsdk/consumer"
+	"github.com/2997215859/gomdsdk/timescale"
+	"github.com/klauspost/compress/zstd"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+const DefaultMaxFileSize = 1 << 30 // 1GB
+
+const IndexFile = "index.jsonl"
+
+const DefaultIndexInterval = time.Minute
+
+// PartitionRange 记录一个文件中某个 partition 的 offset 范围(左闭右闭)
+type PartitionRange struct {
+	Topic       string `json:"topic"`
+	Partition   int    `json:"partition"`
+	FirstOffset int64  `json:"first_offset"`
+	LastOffset  int64  `json:"last_offset"`
+	Count       int64  `json:"count"`
+}
+
+/*
+IndexEntry 是 index.jsonl 中的一行: 文件打开时, 之后每隔 IndexInterval 以及关闭时各追加一行,
+同一文件以最后一行为准(ReadIndex 已合并), 进程异常退出时最后一行的 Closed 为 false
+*/
+type IndexEntry struct {
+	File       string            `json:"file"`
+	Day        string            `json:"day"` // YYYYMMDD, 按收到消息的北京时间
+	FirstRecv  time.Time         `json:"first_recv"`
+	LastRecv   time.Time         `json:"last_recv"`
+	Count      int64             `json:"count"`
+	Size       int64             `json:"size"`
+	Partitions []*PartitionRange `json:"partitions"`
+	Closed     bool              `json:"closed"`
+}
+
+/*
+Recorder 把 consumer 收到的每条原始消息以 consumer.Record 的格式写入按天和大小切分的压缩文件,
+文件名形如 md-20230823-0001.jsonl.gz, 可直接用 consumer.NewFileSource 回放:
+
+	rec, _ := recorder.NewRecorder("/data/md")
+	c := consumer.NewConsumer("snapshot", brokers, consumer.WithRawCallback(rec.Record))
+*/
+type Recorder struct {
+	Dir           string
+	Prefix        string
+	MaxFileSize   int64         // 单个文件的最大字节数(压缩后), 0 表示不按大小切分
+	Compression   string        // CompressionGzip(默认), CompressionZstd 或 CompressionNone
+	FlushInterval time.Duration // 距上次刷盘超过该时间时刷盘, 0 表示每条都刷
+	IndexInterval time.Duration // 距上次写入 index.jsonl 超过该时间时刷盘并追加当前文件的 IndexEntry, 0 表示只在打开和关闭时写入
+	ErrorHandler  func(err error)
+	Logger        *slog.Logger // Record 写入失败且未设置 ErrorHandler 时输出错误, 默认 slog.Default()
+
+	mtx       sync.Mutex
+	file      *os.File
+	counter   *countingWriter
+	compress  io.WriteCloser
+	buf       *bufio.Writer
+	encoder   *json.Encoder
+	lastFlush time.Time
+	lastIndex time.Time
+	seq       int
+	entry     *IndexEntry
+	ranges    map[consumer.TopicPartition]*PartitionRange
+}
+
+func NewRecorder(dir string, opts ...Option) (*Recorder, error) {
+	recorder := &Recorder{
+		Dir:           dir,
+		Prefix:        "md",
+		MaxFileSize:   DefaultMaxFileSize,
+		Compression:   CompressionGzip,
+		FlushInterval: time.Second,
+		IndexInterval: DefaultIndexInterval,
+	}
+
+	for _, o := range opts {
+		o(recorder)
+	}
+
+	switch recorder.Compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return nil, fmt.Errorf("unknown compression(%s)", recorder.Compression)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return recorder, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (r *Recorder) ext() string {
+	switch r.Compression {
+	case CompressionGzip:
+		return ".jsonl.gz"
+	case CompressionZstd:
+		return ".jsonl.zst"
+	}
+	return ".jsonl"
+}
+
+// nextSeq 返回 day 当天下一个文件序号, 重启后不会覆盖已有文件
+func (r *Recorder) nextSeq(day string) int {
+	matches, _ := filepath.Glob(filepath.Join(r.Dir, fmt.Sprintf("%s-%s-*%s", r.Prefix, day, r.ext())))
+	seq := 0
+	for _, match := range matches {
+		var n int
+		name := strings.TrimSuffix(filepath.Base(match), r.ext())
+		if _, err := fmt.Sscanf(name[len(r.Prefix)+len(day)+2:], "%d", &n); err == nil && n > seq {
+			seq = n
+		}
+	}
+	return seq + 1
+}
+
+func (r *Recorder) open(day string) error {
+	if r.seq == 0 || r.entry == nil || r.entry.Day != day {
+		r.seq = r.nextSeq(day)
+	} else {
+		r.seq++
+	}
+
+	name := fmt.Sprintf("%s-%s-%04d%s", r.Prefix, day, r.seq, r.ext())
+	file, err := os.OpenFile(filepath.Join(r.Dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	r.file = file
+	r.counter = &countingWriter{w: file}
+
+	var w io.Writer = r.counter
+	switch r.Compression {
+	case CompressionGzip:
+		r.compress = gzip.NewWriter(r.counter)
+		w = r.compress
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(r.counter)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		r.compress = zw
+		w = r.compress
+	}
+
+	r.buf = bufio.NewWriterSize(w, 1<<20)
+	r.encoder = json.NewEncoder(r.buf)
+	r.entry = &IndexEntry{File: name, Day: day}
+	r.ranges = make(map[consumer.TopicPartition]*PartitionRange)
+	return r.appendIndex(r.indexEntry())
+}
+
+func (r *Recorder) flush() error {
+	if err := r.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := r.compress.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexEntry 返回当前文件到目前为止的 IndexEntry
+func (r *Recorder) indexEntry() *IndexEntry {
+	entry := *r.entry
+	entry.Size = r.counter.n
+	entry.Partitions = make([]*PartitionRange, 0, len(r.ranges))
+	for _, pr := range r.ranges {
+		clone := *pr
+		entry.Partitions = append(entry.Partitions, &clone)
+	}
+	sort.Slice(entry.Partitions, func(i, j int) bool {
+		a, b := entry.Partitions[i], entry.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	return &entry
+}
+
+// closeFile 关闭当前文件并把它最终的 offset 范围写入 index.jsonl
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.buf.Flush()
+	if r.compress != nil {
+		if cerr := r.compress.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+
+	entry := r.indexEntry()
+	entry.Closed = true
+	if ierr := r.appendIndex(entry); err == nil {
+		err = ierr
+	}
+	return err
+}
+
+func (r *Recorder) appendIndex(entry *IndexEntry) error {
+	f, err := os.OpenFile(filepath.Join(r.Dir, IndexFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewEncoder(f).Encode(entry)
+}
+
+// Write 写入一条消息, 必要时切换到新文件
+func (r *Recorder) Write(m *kafkago.Message, recvTime time.Time) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	day := recvTime.In(timescale.Location).Format("20060102")
+	if r.file != nil && (r.entry.Day != day || (r.MaxFileSize > 0 && r.counter.n >= r.MaxFileSize)) {
+		if err := r.closeFile(); err != nil {
+			return err
+		}
+	}
+	if r.file == nil {
+		if err := r.open(day); err != nil {
+			return err
+		}
+		r.lastIndex = recvTime
+	}
+
+	record := consumer.NewRecord(m)
+	record.RecvTime = recvTime
+	if err := r.encoder.Encode(record); err != nil {
+		return err
+	}
+
+	if r.entry.Count == 0 {
+		r.entry.FirstRecv = recvTime
+	}
+	r.entry.LastRecv = recvTime
+	r.entry.Count++
+
+	tp := consumer.TopicPartition{Topic: m.Topic, Partition: m.Partition}
+	pr, ok := r.ranges[tp]
+	if !ok {
+		pr = &PartitionRange{Topic: m.Topic, Partition: m.Partition, FirstOffset: m.Offset}
+		r.ranges[tp] = pr
+	}
+	pr.LastOffset = m.Offset
+	pr.Count++
+
+	if r.IndexInterval > 0 && recvTime.Sub(r.lastIndex) >= r.IndexInterval {
+		// 先刷盘, 使 index 中的范围都已落盘
+		r.lastFlush, r.lastIndex = recvTime, recvTime
+		if err := r.flush(); err != nil {
+			return err
+		}
+		return r.appendIndex(r.indexEntry())
+	}
+	if recvTime.Sub(r.lastFlush) >= r.FlushInterval {
+		r.lastFlush = recvTime
+		return r.flush()
+	}
+	return nil
+}
+
+// Record 可直接作为 consumer.RawCallback 使用, 写入失败交给 ErrorHandler, 未设置时输出到 Logger
+func (r *Recorder) Record(m *kafkago.Message, recvTime time.Time) {
+	err := r.Write(m, recvTime)
+	if err == nil {
+		return
+	}
+	if r.ErrorHandler != nil {
+		r.ErrorHandler(err)
+		return
+	}
+
+	logger := r.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.Error("recorder write error", slog.String("error", err.Error()), slog.String("topic", m.Topic),
+		slog.Int("partition", m.Partition), slog.Int64("offset", m.Offset))
+}
+
+func (r *Recorder) Flush() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	return r.flush()
+}
+
+func (r *Recorder) Close() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.closeFile()
+}
+
+// ReadIndex 读取 dir 下的 index.jsonl, 同一文件只保留最后一行, 按文件第一次出现的顺序返回
+func ReadIndex(dir string) ([]*IndexEntry, error) {
+	f, err := os.Open(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*IndexEntry
+	files := make(map[string]int)
+	dec := json.NewDecoder(f)
+	for {
+		entry := &IndexEntry{}
+		if err := dec.Decode(entry); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, err
+		}
+		if i, ok := files[entry.File]; ok {
+			entries[i] = entry
+			continue
+		}
+		files[entry.File] = len(entries)
+		entries = append(entries, entry)
+	}
+}
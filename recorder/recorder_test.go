@@ -0,0 +1,150 @@
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2997215859/gomdsdk/consumer"
+	"github.com/2997215859/gomdsdk/timescale"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir, WithMaxFileSize(1), WithCompression(CompressionZstd))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day1 := timescale.TradingTime(20230823, 150000000)
+	day2 := timescale.TradingTime(20230824, 93000000)
+	value := []byte(`{"type":1,"data":{"stock_id":"000001.SZ","time":93000000}}`)
+
+	// MaxFileSize 为 1 字节, 每个文件只写得下一条; 第三条跨天
+	for i, recv := range []time.Time{day1, day1, day2} {
+		m := &kafkago.Message{Topic: "snapshot", Partition: 3, Offset: int64(100 + i), Key: []byte("snapshot"), Value: value, Time: recv}
+		if err := rec.Write(m, recv.Add(time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ReadIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []string{"md-20230823-0001.jsonl.zst", "md-20230823-0002.jsonl.zst", "md-20230824-0001.jsonl.zst"}
+	if len(entries) != len(wantFiles) {
+		t.Fatalf("index has %d entries, want %d", len(entries), len(wantFiles))
+	}
+
+	var paths []string
+	for i, entry := range entries {
+		if entry.File != wantFiles[i] {
+			t.Errorf("entries[%d].File = %s, want %s", i, entry.File, wantFiles[i])
+		}
+		if pr := entry.Partitions[0]; pr.Partition != 3 || pr.FirstOffset != int64(100+i) || pr.Count != 1 {
+			t.Errorf("entries[%d] partition range = %+v", i, pr)
+		}
+		paths = append(paths, filepath.Join(dir, entry.File))
+	}
+
+	source, err := consumer.NewFileSource(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	for i := 0; ; i++ {
+		m, err := source.FetchMessage(context.Background())
+		if err == io.EOF {
+			if i != 3 {
+				t.Errorf("read %d messages back, want 3", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Offset != int64(100+i) || string(m.Value) != string(value) || m.Partition != 3 {
+			t.Errorf("message %d = %+v", i, m)
+		}
+	}
+}
+
+func TestRecorderIndex(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := NewRecorder(dir, WithIndexInterval(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := timescale.TradingTime(20230823, 93000000)
+	value := []byte(`{"type":1,"data":{"stock_id":"000001.SZ","time":93000000}}`)
+	write := func(offset int64, recv time.Time) {
+		if err := rec.Write(&kafkago.Message{Topic: "snapshot", Offset: offset, Key: []byte("snapshot"), Value: value}, recv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index := func() string {
+		entries, err := ReadIndex(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ss []string
+		for _, e := range entries {
+			ss = append(ss, fmt.Sprintf("%s %d %v", e.File, e.Count, e.Closed))
+		}
+		return strings.Join(ss, ",")
+	}
+
+	// 打开文件时即写入
+	write(0, start)
+	if got := index(); got != "md-20230823-0001.jsonl.gz 0 false" {
+		t.Errorf("index after open = %s", got)
+	}
+
+	// 超过 IndexInterval 时更新, 未关闭的文件也能从 index 中找到已落盘的范围
+	write(1, start.Add(500*time.Millisecond))
+	write(2, start.Add(time.Second))
+	if got := index(); got != "md-20230823-0001.jsonl.gz 3 false" {
+		t.Errorf("index after interval = %s", got)
+	}
+
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := index(); got != "md-20230823-0001.jsonl.gz 3 true" {
+		t.Errorf("index after close = %s", got)
+	}
+}
+
+func TestRecordError(t *testing.T) {
+	var buf bytes.Buffer
+	rec, err := NewRecorder(t.TempDir(), WithLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 写入失败时输出到 Logger
+	rec.Dir = filepath.Join(rec.Dir, "missing")
+	rec.Record(&kafkago.Message{Topic: "snapshot", Offset: 7, Key: []byte("snapshot")}, time.Now())
+	if out := buf.String(); !strings.Contains(out, "recorder write error") || !strings.Contains(out, "offset=7") {
+		t.Errorf("log = %q", out)
+	}
+
+	var errs []error
+	rec.ErrorHandler = func(err error) { errs = append(errs, err) }
+	rec.Record(&kafkago.Message{Topic: "snapshot", Offset: 8, Key: []byte("snapshot")}, time.Now())
+	if len(errs) != 1 {
+		t.Errorf("errs = %v, want 1", errs)
+	}
+}
@@ -0,0 +1,37 @@
+package replay
+
+import (
+	"time"
+
+	"github.com/2997215859/gomdsdk/codec"
+)
+
+type Option func(replayer *Replayer)
+
+// WithSpeed 1 为实时, N 为 N 倍速, SpeedAsFastAsPossible 为尽快
+func WithSpeed(speed float64) Option {
+	return func(replayer *Replayer) {
+		replayer.speed = speed
+	}
+}
+
+// WithMaxWait 限制两条消息之间的最长等待, 用于跳过午间休市等长时间无行情的区间
+func WithMaxWait(maxWait time.Duration) Option {
+	return func(replayer *Replayer) {
+		replayer.maxWait = maxWait
+	}
+}
+
+// WithSeek 从交易所时间 timeInt(HHMMSSmmm) 开始回放
+func WithSeek(timeInt int) Option {
+	return func(replayer *Replayer) {
+		replayer.seekTo = timeInt
+	}
+}
+
+// WithCodec 指定没有 codec.Header 的消息的编码, 用于取出交易所时间, 默认为 codec.JSON
+func WithCodec(cd codec.Codec) Option {
+	return func(replayer *Replayer) {
+		replayer.codec = cd
+	}
+}
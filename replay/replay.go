@@ -0,0 +1,295 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/2997215859/gomdsdk/codec"
+	"github.com/2997215859/gomdsdk/consumer"
+	"github.com/2997215859/gomdsdk/timescale"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+const (
+	SpeedAsFastAsPossible = 0
+	SpeedRealTime         = 1
+)
+
+// Rewinder 由可以从头重新读取的 Source 实现, 如 *consumer.FileSource, 用于向前 Seek
+type Rewinder interface {
+	Rewind() error
+}
+
+/*
+Replayer 包装一个 Source(通常是 consumer.FileSource), 按消息中的交易所时间(HHMMSSmmm)控制发送节奏,
+自身也是一个 consumer.Source, 因此回调与 TiMgr 的行为与实盘一致.
+回放多天的文件时按消息的 kafka 时间(北京时间)区分日期, 换日或交易所时间早于节奏基准时重新以当前消息为基准:
+
+	source, _ := consumer.NewFileSource(files...)
+	r := replay.NewReplayer(source, replay.WithSpeed(10))
+	c := consumer.NewSourceConsumer(r, consumer.WithSnapshotCallback(cb), consumer.WithSnapshotTiMgr(tiMgr))
+	c.Run()
+*/
+type Replayer struct {
+	source consumer.Source
+	codec  codec.Codec // 没有 codec.Header 的消息的编码
+
+	mtx     sync.Mutex
+	changed chan struct{} // 状态变化时关闭并替换, 唤醒等待中的 FetchMessage
+
+	speed   float64       // 1 为实时, N 为 N 倍速, 0 为尽快
+	maxWait time.Duration // 两条消息之间最多等待的时间, 0 表示不限制
+	paused  bool
+	seekTo  int  // 待 Seek 的时间(HHMMSSmmm), -1 表示没有
+	seekDay int  // seekTo 所在的日期(YYYYMMDD), 0 表示第一条消息所在的日期
+	rewind  bool // Seek 到已经过的时间, 需要从头读取
+
+	anchored bool
+	baseMD   int64     // 节奏基准: 交易所时间(ms)
+	baseDay  int       // 节奏基准: 日期(YYYYMMDD), 0 为未知
+	baseWall time.Time // 节奏基准: 墙上时间
+	lastMD   int       // 最近发出的消息的交易所时间
+	lastDay  int       // 最近发出的消息的日期
+}
+
+func NewReplayer(source consumer.Source, opts ...Option) *Replayer {
+	replayer := &Replayer{
+		source:  source,
+		codec:   codec.JSON,
+		changed: make(chan struct{}),
+		speed:   SpeedRealTime,
+		seekTo:  -1,
+	}
+
+	for _, o := range opts {
+		o(replayer)
+	}
+	return replayer
+}
+
+// notify 需持有 mtx 调用
+func (r *Replayer) notify() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+	r.anchored = false
+}
+
+func (r *Replayer) Pause() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.paused = true
+	r.notify()
+}
+
+func (r *Replayer) Resume() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.paused = false
+	r.notify()
+}
+
+func (r *Replayer) SetSpeed(speed float64) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.speed = speed
+	r.notify()
+}
+
+/*
+Seek 跳到最近发出的消息所在日期(还没有发出消息时为第一天)的交易所时间 timeInt(HHMMSSmmm), 之前的消息被丢弃;
+向后跳时若先到了下一天, 从下一天的开头继续. 向前跳需要 Source 实现 Rewinder,
+注意 TiMgr 的 ti 只增不减, 向前跳不会重新触发已经过的 ti
+*/
+func (r *Replayer) Seek(timeInt int) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.seekDay = r.lastDay
+	if timeInt < r.lastMD {
+		if _, ok := r.source.(Rewinder); !ok {
+			return fmt.Errorf("source does not support seeking backward")
+		}
+		r.rewind = true
+	}
+
+	r.seekTo = timeInt
+	r.notify()
+	return nil
+}
+
+// Time 返回最近发出的消息的交易所时间(HHMMSSmmm)
+func (r *Replayer) Time() int {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.lastMD
+}
+
+var errSkip = errors.New("skip message")
+
+func (r *Replayer) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	for {
+		r.mtx.Lock()
+		rewind := r.rewind
+		r.rewind = false
+		r.mtx.Unlock()
+
+		// Rewind 与 FetchMessage 在同一个 goroutine 中调用
+		if rewind {
+			if err := r.source.(Rewinder).Rewind(); err != nil {
+				return kafkago.Message{}, err
+			}
+		}
+
+		m, err := r.source.FetchMessage(ctx)
+		if err != nil {
+			return m, err
+		}
+
+		err = r.wait(ctx, exchangeTime(&m, r.codec), dayOf(&m))
+		if err == errSkip {
+			continue
+		}
+		if err != nil {
+			return kafkago.Message{}, err
+		}
+		return m, nil
+	}
+}
+
+// dayOf 返回消息的 kafka 时间所在的北京时间日期(YYYYMMDD), 没有时间时返回 0
+func dayOf(m *kafkago.Message) int {
+	if m.Time.IsZero() {
+		return 0
+	}
+	y, mon, d := m.Time.In(timescale.Location).Date()
+	return y*10000 + int(mon)*100 + d
+}
+
+// skip 需持有 mtx 调用, 返回消息是否因 Seek 需要丢弃
+func (r *Replayer) skip(mdTime int, day int) bool {
+	if r.seekTo < 0 {
+		return false
+	}
+	if r.seekDay == 0 {
+		r.seekDay = day
+	}
+	if day != 0 && r.seekDay != 0 {
+		if day < r.seekDay {
+			return true // 从头读取时之前的日期
+		}
+		if day > r.seekDay {
+			r.seekTo = -1 // 已到下一天
+			return false
+		}
+	}
+	if mdTime > 0 && mdTime < r.seekTo {
+		return true
+	}
+	r.seekTo = -1
+	return false
+}
+
+// sent 需持有 mtx 调用, 记录发出的消息
+func (r *Replayer) sent(mdTime int, day int) {
+	if mdTime > 0 {
+		r.lastMD = mdTime
+	}
+	if day != 0 {
+		r.lastDay = day
+	}
+}
+
+// wait 在暂停时阻塞, 否则按速度等到 mdTime 对应的墙上时间; 消息因 Seek 需要丢弃时返回 errSkip
+func (r *Replayer) wait(ctx context.Context, mdTime int, day int) error {
+	for {
+		r.mtx.Lock()
+		changed := r.changed
+
+		if r.rewind || r.skip(mdTime, day) {
+			r.mtx.Unlock()
+			return errSkip
+		}
+
+		if r.paused {
+			r.mtx.Unlock()
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if mdTime <= 0 || r.speed <= SpeedAsFastAsPossible {
+			r.sent(mdTime, day)
+			r.mtx.Unlock()
+			return nil
+		}
+
+		millis := timescale.IntTime2Millis(mdTime)
+		// 换日(多天的文件)或时间早于基准时, 以当前消息为基准, 否则之后的消息都会被立即发出
+		if !r.anchored || (day != 0 && day != r.baseDay) || millis < r.baseMD {
+			r.anchored = true
+			r.baseMD = millis
+			r.baseDay = day
+			r.baseWall = time.Now()
+		}
+
+		due := r.baseWall.Add(time.Duration(float64(millis-r.baseMD) / r.speed * float64(time.Millisecond)))
+		delay := time.Until(due)
+		if r.maxWait > 0 && delay > r.maxWait {
+			// 如午间休市, 重新以当前消息为基准
+			delay = r.maxWait
+			r.baseMD = millis
+			r.baseWall = time.Now().Add(delay)
+		}
+		if delay <= 0 {
+			r.sent(mdTime, day)
+			r.mtx.Unlock()
+			return nil
+		}
+		r.mtx.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			r.mtx.Lock()
+			r.sent(mdTime, day)
+			r.mtx.Unlock()
+			return nil
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *Replayer) Close() error {
+	return r.source.Close()
+}
+
+// ExchangeTime 返回消息体中的交易所时间(HHMMSSmmm), 按消息的 codec.Header 选择编码, 默认为 JSON; 没有时返回 0
+func ExchangeTime(m *kafkago.Message) int {
+	return exchangeTime(m, codec.JSON)
+}
+
+func exchangeTime(m *kafkago.Message, def codec.Codec) int {
+	cd, ok, err := codec.FromHeader(m)
+	if err != nil {
+		return 0
+	}
+	if !ok {
+		cd = def
+	}
+	t, _ := cd.Time(m.Value)
+	return t
+}
@@ -0,0 +1,163 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/2997215859/gomdsdk/datatype"
+	"github.com/2997215859/gomdsdk/timescale"
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+type sliceSource struct {
+	messages []kafkago.Message
+	idx      int
+}
+
+func (s *sliceSource) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	if s.idx >= len(s.messages) {
+		return kafkago.Message{}, io.EOF
+	}
+	s.idx++
+	return s.messages[s.idx-1], nil
+}
+
+func (s *sliceSource) Rewind() error {
+	s.idx = 0
+	return nil
+}
+
+func (s *sliceSource) Close() error {
+	return nil
+}
+
+func newSliceSource(times ...int) *sliceSource {
+	source := &sliceSource{}
+	for i, t := range times {
+		source.messages = append(source.messages, kafkago.Message{
+			Offset: int64(i),
+			Key:    []byte(datatype.KeySnapshot),
+			Value:  []byte(fmt.Sprintf(`{"type":1,"data":{"stock_id":"000001.SZ","time":%d}}`, t)),
+		})
+	}
+	return source
+}
+
+func fetchAll(t *testing.T, r *Replayer) []int64 {
+	var offsets []int64
+	for {
+		m, err := r.FetchMessage(context.Background())
+		if err == io.EOF {
+			return offsets
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, m.Offset)
+	}
+}
+
+func TestReplayerSpeed(t *testing.T) {
+	// 交易所时间跨度 400ms, 10 倍速约 40ms
+	r := NewReplayer(newSliceSource(93000000, 93000100, 93000400), WithSpeed(10))
+
+	start := time.Now()
+	offsets := fetchAll(t, r)
+	elapsed := time.Since(start)
+
+	if len(offsets) != 3 {
+		t.Fatalf("offsets = %v", offsets)
+	}
+	if elapsed < 35*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Errorf("elapsed = %s, want about 40ms", elapsed)
+	}
+}
+
+func TestReplayerMaxWait(t *testing.T) {
+	// 跨越午休, 实时回放时最多等待 MaxWait
+	r := NewReplayer(newSliceSource(112959000, 130000000), WithMaxWait(20*time.Millisecond))
+
+	start := time.Now()
+	fetchAll(t, r)
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("elapsed = %s, want about 20ms", elapsed)
+	}
+}
+
+func TestReplayerSeek(t *testing.T) {
+	r := NewReplayer(newSliceSource(93000000, 93100000, 93200000, 93300000), WithSpeed(SpeedAsFastAsPossible), WithSeek(93200000))
+
+	offsets := fetchAll(t, r)
+	if len(offsets) != 2 || offsets[0] != 2 {
+		t.Errorf("offsets after seek = %v, want [2 3]", offsets)
+	}
+
+	// 向前跳需要 Rewind
+	if err := r.Seek(93100000); err != nil {
+		t.Fatal(err)
+	}
+	offsets = fetchAll(t, r)
+	if len(offsets) != 3 || offsets[0] != 1 {
+		t.Errorf("offsets after seek backward = %v, want [1 2 3]", offsets)
+	}
+}
+
+func TestReplayerPause(t *testing.T) {
+	r := NewReplayer(newSliceSource(93000000, 93000001), WithSpeed(SpeedAsFastAsPossible))
+	r.Pause()
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		r.Resume()
+	}()
+
+	start := time.Now()
+	fetchAll(t, r)
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("elapsed = %s, fetch should block while paused", elapsed)
+	}
+}
+
+// newDaysSource 返回两天的消息, 每天的交易所时间都为 times
+func newDaysSource(times ...int) *sliceSource {
+	source := newSliceSource(append(append([]int(nil), times...), times...)...)
+	for i := range source.messages {
+		day := 20230823
+		if i >= len(times) {
+			day = 20230824
+		}
+		source.messages[i].Time = timescale.TradingTime(day, 150000000)
+	}
+	return source
+}
+
+func TestReplayerDays(t *testing.T) {
+	// 每天的交易所时间跨度 500ms, 10 倍速每天约 50ms; 第二天重新定基准, 不会被立即发出
+	r := NewReplayer(newDaysSource(93000000, 93000500), WithSpeed(10))
+	start := time.Now()
+	if offsets := fetchAll(t, r); len(offsets) != 4 {
+		t.Fatalf("offsets = %v", offsets)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("elapsed = %s, want about 100ms", elapsed)
+	}
+}
+
+func TestReplayerSeekDays(t *testing.T) {
+	// 第一天没有晚于 Seek 时间的消息, 从第二天的开头继续
+	r := NewReplayer(newDaysSource(93000000, 93100000), WithSpeed(SpeedAsFastAsPossible), WithSeek(93200000))
+	if offsets := fetchAll(t, r); fmt.Sprint(offsets) != "[2 3]" {
+		t.Errorf("offsets after seek = %v, want [2 3]", offsets)
+	}
+
+	// 向前跳到最近发出的消息所在的第二天, 而不是第一天
+	if err := r.Seek(93000000); err != nil {
+		t.Fatal(err)
+	}
+	if offsets := fetchAll(t, r); fmt.Sprint(offsets) != "[2 3]" {
+		t.Errorf("offsets after seek backward = %v, want [2 3]", offsets)
+	}
+}
@@ -39,6 +39,39 @@ func NewTimeScale(startTime, endTime string, scale int) *TimeScale {
 	return timescale
 }
 
+/*
+NewSessionTimeScale 与 NewTimeScale 相同, 但上午与下午分别从 startTime 与 13:00:00 开始按 scale 划分:
+NewTimeScale 从 startTime 起连续划分, scale 不整除 09:30-13:00 时(如 3600)会有跨越午休的 ti;
+这里 scale 不整除一段交易时间时该段最后一个 ti 较短, 如 3600 为 09:30, 10:30, 13:00, 14:00
+*/
+func NewSessionTimeScale(startTime, endTime string, scale int) *TimeScale {
+	timescale := NewTimeScale(startTime, endTime, scale)
+	date := carbon.Now().ToDateString()
+	zero := carbon.Parse(date + " 00:00:00")
+	lunchStart := zero.DiffInSeconds(carbon.Parse(date + " 11:30:00"))
+	lunchEnd := zero.DiffInSeconds(carbon.Parse(date + " 13:00:00"))
+
+	var minutes []string
+	add := func(t int64) {
+		minutes = append(minutes, zero.AddSeconds(int(t)).ToTimeString())
+	}
+	for t := timescale.StartTime; t < timescale.EndTime && t < lunchStart; t += timescale.Scale {
+		add(t)
+	}
+	start := timescale.StartTime
+	if start < lunchEnd {
+		start = lunchEnd
+	}
+	for t := start; t < timescale.EndTime; t += timescale.Scale {
+		add(t)
+	}
+	add(timescale.EndTime)
+
+	timescale.Minutes = minutes
+	timescale.MinuteSize = len(minutes)
+	return timescale
+}
+
 func (timescale *TimeScale) GetTi(timestr string) int {
 	if len(timestr) != 8 {
 		return -1
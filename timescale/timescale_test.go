@@ -28,8 +28,40 @@ func TestNewTimeScale(t *testing.T) {
 	t.Logf("ti = %d, timestr = %s, ", ti, timescale.Ti2Time(ti))
 }
 
+func TestNewSessionTimeScale(t *testing.T) {
+	for _, tt := range []struct {
+		scale int
+		want  string
+	}{
+		// 下午从 13:00:00 重新开始, 不整除时每段最后一个 ti 较短
+		{3600, "[09:30:00 10:30:00 13:00:00 14:00:00 15:00:00]"},
+		{2700, "[09:30:00 10:15:00 11:00:00 13:00:00 13:45:00 14:30:00 15:00:00]"},
+		{1800, fmt.Sprint(NewTimeScale("09:30:00", "15:00:00", 1800).Minutes)},
+		{3, fmt.Sprint(NewTimeScale("09:30:00", "15:00:00", 3).Minutes)},
+	} {
+		ts := NewSessionTimeScale("09:30:00", "15:00:00", tt.scale)
+		if got := fmt.Sprint(ts.Minutes); got != tt.want {
+			t.Errorf("scale %d: minutes = %s, want %s", tt.scale, got, tt.want)
+		}
+	}
+
+	ts := NewSessionTimeScale("09:30:00", "15:00:00", 3600)
+	for timestr, ti := range map[string]int{"11:29:59": 2, "13:00:00": 3, "13:59:59": 3, "14:00:00": 4} {
+		if got := ts.GetTi(timestr); got != ti {
+			t.Errorf("GetTi(%s) = %d, want %d", timestr, got, ti)
+		}
+	}
+}
+
 func TestIntTime2Time(t *testing.T) {
 	//timeInt := 93000
 	timeInt := 93000111
 	t.Logf("%s", IntTime2Time(timeInt))
 }
+
+func TestTradingTime(t *testing.T) {
+	tm := TradingTime(20230823, 91503190)
+	if s := tm.Format("2006-01-02 15:04:05.000"); s != "2023-08-23 09:15:03.190" {
+		t.Errorf("TradingTime = %s", s)
+	}
+}
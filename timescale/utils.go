@@ -1,6 +1,9 @@
 package timescale
 
-import "strconv"
+import (
+	"strconv"
+	"time"
+)
 
 // 91503190 => 09:15:03
 // 91503 => 09:15:03
@@ -18,3 +21,19 @@ func IntTime2Time(timeInt int) string {
 	}
 	return timestr[0:2] + ":" + timestr[2:4] + ":" + timestr[4:6]
 }
+
+// 交易所时间均为北京时间
+var Location = time.FixedZone("CST", 8*3600)
+
+// 20230823, 91503190 => 2023-08-23 09:15:03.190 +0800 CST
+func TradingTime(tradingDay int, timeInt int) time.Time {
+	year, month, day := tradingDay/10000, tradingDay/100%100, tradingDay%100
+	hour, minute, second, millis := timeInt/10000000, timeInt/100000%100, timeInt/1000%100, timeInt%1000
+	return time.Date(year, time.Month(month), day, hour, minute, second, millis*int(time.Millisecond), Location)
+}
+
+// 91503190 => 33303190 (自 00:00:00 起的毫秒数)
+func IntTime2Millis(timeInt int) int64 {
+	hour, minute, second, millis := timeInt/10000000, timeInt/100000%100, timeInt/1000%100, timeInt%1000
+	return int64(((hour*60+minute)*60+second)*1000 + millis)
+}